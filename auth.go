@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// APIKeyConfig describes a single API key entry in the keys file
+type APIKeyConfig struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Admin       bool   `json:"admin,omitempty"`
+	Quota       int64  `json:"quota,omitempty"`       // Max requests per quota period (0 = unlimited)
+	QuotaPeriod string `json:"quotaPeriod,omitempty"` // Go duration string, defaults to 24h
+}
+
+// APIKeysFile is the on-disk format of the API keys file
+type APIKeysFile struct {
+	Keys []APIKeyConfig `json:"keys"`
+}
+
+// KeyUsage holds the usage counters for a single API key
+type KeyUsage struct {
+	Requests     int64 `json:"requests"`
+	Extractions  int64 `json:"extractions"`
+	BytesProxied int64 `json:"bytesProxied"`
+	Errors       int64 `json:"errors"`
+}
+
+// KeyUsageReport is the admin view of a single API key's usage
+type KeyUsageReport struct {
+	Name        string    `json:"name"`
+	Admin       bool      `json:"admin,omitempty"`
+	Quota       int64     `json:"quota,omitempty"`
+	QuotaUsed   int64     `json:"quotaUsed"`
+	QuotaResets time.Time `json:"quotaResets,omitempty"`
+	Usage       KeyUsage  `json:"usage"`
+}
+
+// apiKey is the runtime state of a configured API key
+type apiKey struct {
+	config      APIKeyConfig
+	quotaPeriod time.Duration
+
+	requests     atomic.Int64
+	extractions  atomic.Int64
+	bytesProxied atomic.Int64
+	errors       atomic.Int64
+
+	mu          sync.Mutex
+	windowStart time.Time
+	windowUsed  int64
+}
+
+// APIKeyStore holds all configured API keys and their usage counters
+type APIKeyStore struct {
+	keys []*apiKey
+}
+
+type apiKeyContextKey struct{}
+
+// LoadAPIKeys reads API keys from a JSON file
+func LoadAPIKeys(path string) (*APIKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %v", err)
+	}
+
+	var file APIKeysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %v", err)
+	}
+
+	return NewAPIKeyStore(file.Keys)
+}
+
+// NewAPIKeyStore validates key configs and builds a store from them
+func NewAPIKeyStore(configs []APIKeyConfig) (*APIKeyStore, error) {
+	store := &APIKeyStore{}
+	seen := make(map[string]bool)
+
+	for i, cfg := range configs {
+		if cfg.Key == "" {
+			return nil, fmt.Errorf("API key #%d has an empty key", i+1)
+		}
+		if seen[cfg.Key] {
+			return nil, fmt.Errorf("API key #%d (%s) is a duplicate", i+1, cfg.Name)
+		}
+		seen[cfg.Key] = true
+
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("key-%d", i+1)
+		}
+
+		period := 24 * time.Hour
+		if cfg.QuotaPeriod != "" {
+			d, err := time.ParseDuration(cfg.QuotaPeriod)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("API key %s has invalid quotaPeriod %q", cfg.Name, cfg.QuotaPeriod)
+			}
+			period = d
+		}
+
+		store.keys = append(store.keys, &apiKey{config: cfg, quotaPeriod: period})
+	}
+
+	return store, nil
+}
+
+// lookup finds the key matching the presented secret using constant-time comparison
+func (s *APIKeyStore) lookup(secret string) *apiKey {
+	var found *apiKey
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(k.config.Key), []byte(secret)) == 1 {
+			found = k
+		}
+	}
+	return found
+}
+
+// consumeQuota counts one request against the key's quota, returning false if exhausted
+func (k *apiKey) consumeQuota(now time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.windowStart.IsZero() || now.Sub(k.windowStart) >= k.quotaPeriod {
+		k.windowStart = now
+		k.windowUsed = 0
+	}
+
+	if k.config.Quota > 0 && k.windowUsed >= k.config.Quota {
+		return false
+	}
+
+	k.windowUsed++
+	return true
+}
+
+// Report returns a snapshot of usage for every configured key
+func (s *APIKeyStore) Report() []KeyUsageReport {
+	reports := make([]KeyUsageReport, 0, len(s.keys))
+	for _, k := range s.keys {
+		k.mu.Lock()
+		report := KeyUsageReport{
+			Name:      k.config.Name,
+			Admin:     k.config.Admin,
+			Quota:     k.config.Quota,
+			QuotaUsed: k.windowUsed,
+		}
+		if !k.windowStart.IsZero() {
+			report.QuotaResets = k.windowStart.Add(k.quotaPeriod)
+		}
+		k.mu.Unlock()
+
+		report.Usage = KeyUsage{
+			Requests:     k.requests.Load(),
+			Extractions:  k.extractions.Load(),
+			BytesProxied: k.bytesProxied.Load(),
+			Errors:       k.errors.Load(),
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// presentedAPIKey reads the API key from the X-API-Key header or a bearer token
+func presentedAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return ""
+}
+
+// apiKeyFromContext returns the authenticated key for a request, or nil when auth is disabled
+func apiKeyFromContext(ctx context.Context) *apiKey {
+	k, _ := ctx.Value(apiKeyContextKey{}).(*apiKey)
+	return k
+}
+
+// recordExtraction counts a successful extraction against the request's key
+func recordExtraction(r *http.Request) {
+	if k := apiKeyFromContext(r.Context()); k != nil {
+		k.extractions.Add(1)
+	}
+}
+
+// recordBytesProxied counts proxied download bytes against the request's key
+func recordBytesProxied(r *http.Request, n int64) {
+	if k := apiKeyFromContext(r.Context()); k != nil && n > 0 {
+		k.bytesProxied.Add(n)
+	}
+}
+
+// recordError counts a failed request against the request's key
+func recordError(r *http.Request) {
+	if k := apiKeyFromContext(r.Context()); k != nil {
+		k.errors.Add(1)
+	}
+}
+
+// writeAuthError writes a JSON error response for auth failures
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   message,
+		Success: false,
+	})
+}
+
+// requireAPIKey wraps a handler with API key authentication and quota enforcement.
+// A nil store disables authentication entirely.
+func requireAPIKey(store *APIKeyStore, next http.HandlerFunc) http.HandlerFunc {
+	if store == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := presentedAPIKey(r)
+		if secret == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="threadsvid"`)
+			writeAuthError(w, http.StatusUnauthorized, "API key required")
+			return
+		}
+
+		key := store.lookup(secret)
+		if key == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="threadsvid", error="invalid_token"`)
+			writeAuthError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+
+		key.requests.Add(1)
+		if !key.consumeQuota(time.Now()) {
+			key.errors.Add(1)
+			loggerFrom(r.Context()).Warn("API key quota exceeded", "key", key.config.Name)
+			writeAuthError(w, http.StatusTooManyRequests, "API key quota exceeded")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// requireAdminKey wraps a handler so only admin API keys may call it.
+// Admin endpoints are disabled entirely when no key store is configured.
+func requireAdminKey(store *APIKeyStore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			writeAuthError(w, http.StatusNotFound, "Admin endpoints require API keys to be configured")
+			return
+		}
+
+		key := store.lookup(presentedAPIKey(r))
+		if key == nil || !key.config.Admin {
+			writeAuthError(w, http.StatusForbidden, "Admin API key required")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// handleAdminUsage reports per-key usage counters
+func handleAdminUsage(store *APIKeyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Error:   "Method not allowed",
+				Success: false,
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": store.Report(),
+			"time": time.Now().Format(time.RFC3339),
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestKeyStore(t *testing.T) *APIKeyStore {
+	t.Helper()
+	store, err := NewAPIKeyStore([]APIKeyConfig{
+		{Key: "user-secret", Name: "user", Quota: 2, QuotaPeriod: "1h"},
+		{Key: "admin-secret", Name: "admin", Admin: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	store := newTestKeyStore(t)
+	handler := requireAPIKey(store, func(w http.ResponseWriter, r *http.Request) {
+		if apiKeyFromContext(r.Context()) == nil {
+			t.Error("handler ran without the key in its context")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"missing key", "", "", http.StatusUnauthorized},
+		{"unknown key", "X-API-Key", "nope", http.StatusUnauthorized},
+		{"header key", "X-API-Key", "admin-secret", http.StatusOK},
+		{"bearer token", "Authorization", "Bearer admin-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/extract", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestRequireAPIKeyQuota(t *testing.T) {
+	store := newTestKeyStore(t)
+	handler := requireAPIKey(store, func(w http.ResponseWriter, r *http.Request) {})
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		r := httptest.NewRequest("GET", "/api/extract", nil)
+		r.Header.Set("X-API-Key", "user-secret")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+
+	report := store.Report()[0]
+	if report.QuotaUsed != 2 || report.Usage.Requests != 3 || report.Usage.Errors != 1 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestQuotaWindowReset(t *testing.T) {
+	store := newTestKeyStore(t)
+	key := store.lookup("user-secret")
+	now := time.Now()
+
+	if !key.consumeQuota(now) || !key.consumeQuota(now.Add(time.Minute)) {
+		t.Fatal("quota exhausted too early")
+	}
+	if key.consumeQuota(now.Add(59 * time.Minute)) {
+		t.Error("quota not enforced within the window")
+	}
+	if !key.consumeQuota(now.Add(time.Hour)) {
+		t.Error("quota did not reset with a new window")
+	}
+}
+
+func TestRequireAdminKey(t *testing.T) {
+	store := newTestKeyStore(t)
+	handler := requireAdminKey(store, handleAdminUsage(store))
+
+	get := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/admin/usage", nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	if w := get(""); w.Code != http.StatusForbidden {
+		t.Errorf("no key: status = %d, want 403", w.Code)
+	}
+	if w := get("user-secret"); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin key: status = %d, want 403", w.Code)
+	}
+
+	w := get("admin-secret")
+	var body struct {
+		Keys []KeyUsageReport `json:"keys"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || w.Code != http.StatusOK || len(body.Keys) != 2 {
+		t.Errorf("admin key: status = %d, body %v, err %v", w.Code, body, err)
+	}
+
+	w = httptest.NewRecorder()
+	requireAdminKey(nil, handleAdminUsage(nil))(w, httptest.NewRequest("GET", "/api/admin/usage", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("without keys: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// BlockingConfig controls which requests extraction pages refuse to load.
+// Blocked requests still have their URLs recorded, and blocked media URLs are
+// themselves an extraction source.
+type BlockingConfig struct {
+	Enabled       bool     `yaml:"enabled" json:"enabled"`
+	ResourceTypes []string `yaml:"resourceTypes" json:"resourceTypes"` // CDP resource types, e.g. Font, Stylesheet, Image, Media
+	URLPatterns   []string `yaml:"urlPatterns" json:"urlPatterns"`     // Fetch URL patterns, * and ? are wildcards
+}
+
+// blockableTypes maps lower-cased names to the resource types that may be
+// blocked. Document is left out: blocking it would block the post itself.
+var blockableTypes = func() map[string]proto.NetworkResourceType {
+	types := make(map[string]proto.NetworkResourceType)
+	for _, t := range []proto.NetworkResourceType{
+		proto.NetworkResourceTypeStylesheet,
+		proto.NetworkResourceTypeImage,
+		proto.NetworkResourceTypeMedia,
+		proto.NetworkResourceTypeFont,
+		proto.NetworkResourceTypeScript,
+		proto.NetworkResourceTypeTextTrack,
+		proto.NetworkResourceTypeXHR,
+		proto.NetworkResourceTypeFetch,
+		proto.NetworkResourceTypePrefetch,
+		proto.NetworkResourceTypeEventSource,
+		proto.NetworkResourceTypeWebSocket,
+		proto.NetworkResourceTypeManifest,
+		proto.NetworkResourceTypePing,
+		proto.NetworkResourceTypeCSPViolationReport,
+		proto.NetworkResourceTypeOther,
+	} {
+		types[strings.ToLower(string(t))] = t
+	}
+	return types
+}()
+
+// compileURLPattern turns a Fetch URL pattern into an anchored regexp. As in
+// Chrome, * and ? are wildcards and a backslash escapes the next character;
+// everything else, regexp metacharacters included, matches literally.
+func compileURLPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	var expr strings.Builder
+	expr.WriteString(`\A`)
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			expr.WriteString(".*")
+		case r == '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("pattern %q ends with an unfinished escape", pattern)
+	}
+	expr.WriteString(`\z`)
+	return regexp.Compile(expr.String())
+}
+
+// compileURLPatterns compiles every pattern, failing on the first bad one
+func compileURLPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	matchers := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		m, err := compileURLPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL pattern %q: %v", pattern, err)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// blockedRequest is one request a page wasn't allowed to make
+type blockedRequest struct {
+	URL  string
+	Type proto.NetworkResourceType
+}
+
+// blockedRequests collects what a page's request interception refused
+type blockedRequests struct {
+	mu       sync.Mutex
+	requests []blockedRequest
+}
+
+func (b *blockedRequests) add(u string, t proto.NetworkResourceType) {
+	b.mu.Lock()
+	b.requests = append(b.requests, blockedRequest{URL: u, Type: t})
+	b.mu.Unlock()
+}
+
+// count returns how many requests were blocked; a nil log has none
+func (b *blockedRequests) count() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.requests)
+}
+
+// urls returns the distinct blocked URLs of type t, in request order
+func (b *blockedRequests) urls(t proto.NetworkResourceType) []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var urls []string
+	seen := make(map[string]bool)
+	for _, r := range b.requests {
+		if r.Type == t && !seen[r.URL] {
+			seen[r.URL] = true
+			urls = append(urls, r.URL)
+		}
+	}
+	return urls
+}
+
+// interceptRequests takes over the page's requests: the blocking config
+// decides which ones fail, and auth challenges from proxy are answered with its
+// credentials. Only the configured types and patterns are paused by the
+// browser, unless the proxy needs credentials, in which case every request is.
+// The returned stop func must run before the page is closed; both results are
+// nil when there is nothing to intercept.
+func (te *ThreadsExtractor) interceptRequests(page *rod.Page, proxy *upstreamProxy) (*blockedRequests, func()) {
+	cfg := te.cfg.Browser.Blocking
+	user, pass, auth := "", "", false
+	if proxy != nil {
+		user, pass, auth = proxy.credentials()
+	}
+
+	types := make(map[proto.NetworkResourceType]bool)
+	var patterns []*proto.FetchRequestPattern
+	var matchers []*regexp.Regexp
+	if cfg.Enabled {
+		matchers = te.blockURLs
+		for _, name := range cfg.ResourceTypes {
+			if t, ok := blockableTypes[strings.ToLower(name)]; ok {
+				types[t] = true
+				patterns = append(patterns, &proto.FetchRequestPattern{URLPattern: "*", ResourceType: t})
+			}
+		}
+		for _, pattern := range cfg.URLPatterns {
+			patterns = append(patterns, &proto.FetchRequestPattern{URLPattern: pattern})
+		}
+	}
+	if auth {
+		// Auth challenges only arrive for intercepted requests
+		patterns = []*proto.FetchRequestPattern{{URLPattern: "*"}}
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	// A pattern may also match the post page itself, which must always load
+	shouldBlock := func(u string, t proto.NetworkResourceType) bool {
+		if t == proto.NetworkResourceTypeDocument {
+			return false
+		}
+		if types[t] {
+			return true
+		}
+		for _, m := range matchers {
+			if m.MatchString(u) {
+				return true
+			}
+		}
+		return false
+	}
+
+	blocked := &blockedRequests{}
+	ctx, cancel := context.WithCancel(page.GetContext())
+	resolve := func(e *proto.FetchRequestPaused) {
+		var err error
+		if shouldBlock(e.Request.URL, e.ResourceType) {
+			blocked.add(e.Request.URL, e.ResourceType)
+			err = proto.FetchFailRequest{RequestID: e.RequestID, ErrorReason: proto.NetworkErrorReasonBlockedByClient}.Call(page)
+		} else {
+			err = proto.FetchContinueRequest{RequestID: e.RequestID}.Call(page)
+		}
+		if err != nil && ctx.Err() == nil {
+			slog.Debug("failed to resolve intercepted request", "url", e.Request.URL, "error", err)
+		}
+	}
+	answer := func(e *proto.FetchAuthRequired) {
+		// Only the proxy gets our credentials, sites asking for auth get the default prompt
+		response := &proto.FetchAuthChallengeResponse{Response: proto.FetchAuthChallengeResponseResponseDefault}
+		if e.AuthChallenge.Source == proto.FetchAuthChallengeSourceProxy {
+			response = &proto.FetchAuthChallengeResponse{
+				Response: proto.FetchAuthChallengeResponseResponseProvideCredentials,
+				Username: user,
+				Password: pass,
+			}
+		}
+		if err := (proto.FetchContinueWithAuth{RequestID: e.RequestID, AuthChallengeResponse: response}).Call(page); err != nil && ctx.Err() == nil {
+			slog.Debug("failed to answer auth challenge", "error", err)
+		}
+	}
+	// Answering from inside the event loop would hold up the next event
+	wait := page.Context(ctx).EachEvent(func(e *proto.FetchRequestPaused) {
+		go resolve(e)
+	}, func(e *proto.FetchAuthRequired) {
+		go answer(e)
+	})
+	go wait()
+
+	if err := (proto.FetchEnable{Patterns: patterns, HandleAuthRequests: auth}).Call(page); err != nil {
+		// The page still works, it just loads everything
+		slog.Warn("failed to set up request interception", "error", err)
+		cancel()
+		return nil, nil
+	}
+
+	return blocked, func() {
+		cancel()
+		proto.FetchDisable{}.Call(page)
+	}
+}
+
+// mediaFromBlockedRequests looks for the post video among the media requests
+// the page tried to make. Segment requests carry a byte range, which is
+// dropped so the URL points at the whole file.
+func (te *ThreadsExtractor) mediaFromBlockedRequests(blocked *blockedRequests) *ExtractResponse {
+	for _, u := range blocked.urls(proto.NetworkResourceTypeMedia) {
+		u = stripByteRange(u)
+		if te.isValidVideoURL(u) {
+			return &ExtractResponse{
+				MediaURL:  u,
+				MediaType: "video",
+				Success:   true,
+			}
+		}
+	}
+	return nil
+}
+
+// stripByteRange removes the bytestart/byteend parameters of a CDN segment URL
+func stripByteRange(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	q := u.Query()
+	if q.Get("bytestart") == "" && q.Get("byteend") == "" {
+		return raw
+	}
+	q.Del("bytestart")
+	q.Del("byteend")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
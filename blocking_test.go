@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func TestStripByteRange(t *testing.T) {
+	tests := map[string]string{
+		"https://scontent.cdninstagram.com/v/clip.mp4?efg=1&bytestart=0&byteend=1024": "https://scontent.cdninstagram.com/v/clip.mp4?efg=1",
+		"https://scontent.cdninstagram.com/v/clip.mp4?efg=1":                          "https://scontent.cdninstagram.com/v/clip.mp4?efg=1",
+	}
+	for in, want := range tests {
+		if got := stripByteRange(in); got != want {
+			t.Errorf("stripByteRange(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMediaFromBlockedRequests(t *testing.T) {
+	te := &ThreadsExtractor{cfg: DefaultConfig()}
+	if got := te.mediaFromBlockedRequests(nil); got != nil {
+		t.Errorf("nil log should give nothing, got %+v", got)
+	}
+
+	blocked := &blockedRequests{}
+	blocked.add("https://static.cdninstagram.com/rsrc.php/font.woff2", proto.NetworkResourceTypeFont)
+	blocked.add("https://scontent.cdninstagram.com/v/clip.mp4?bytestart=0&byteend=99", proto.NetworkResourceTypeMedia)
+	blocked.add("https://scontent.cdninstagram.com/v/clip.mp4?bytestart=100&byteend=199", proto.NetworkResourceTypeMedia)
+
+	if n := len(blocked.urls(proto.NetworkResourceTypeMedia)); n != 2 {
+		t.Errorf("media urls = %d, want 2", n)
+	}
+	got := te.mediaFromBlockedRequests(blocked)
+	if got == nil || got.MediaURL != "https://scontent.cdninstagram.com/v/clip.mp4" || got.MediaType != "video" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestBlockingConfigValidation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Browser.Blocking.ResourceTypes = []string{"font", "Document"}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), `"Document"`) || strings.Contains(err.Error(), `"font"`) {
+		t.Errorf("expected only Document to be rejected, got %v", err)
+	}
+}
+
+func TestCompileURLPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		url     string
+		want    bool
+	}{
+		{"*://*.doubleclick.net/*", "https://ad.doubleclick.net/x", true},
+		{"*://*.doubleclick.net/*", "https://doubleclick.net.evil/x", false},
+		{"*/logging_client_events*", "https://www.threads.net/logging_client_events?a=1", true},
+		{"*/api/v?/feed", "https://x.com/api/v1/feed", true},
+		{"*/api/v?/feed", "https://x.com/api/v10/feed", false},
+		// Regexp metacharacters are literal
+		{"*/a.b/*", "https://x.com/axb/1", false},
+		{"*/a.b/*", "https://x.com/a.b/1", true},
+		{"*/(graphql)+[x]{2}|y", "https://x.com/(graphql)+[x]{2}|y", true},
+		{"*/(graphql)+[x]{2}|y", "https://x.com/graphqlgraphql", false},
+		// A backslash escapes a wildcard
+		{`*/literal\*star`, "https://x.com/literal*star", true},
+		{`*/literal\*star`, "https://x.com/literalXstar", false},
+		{`*/q\?`, "https://x.com/q?", true},
+		{`*/q\?`, "https://x.com/qx", false},
+	}
+	for _, tt := range tests {
+		m, err := compileURLPattern(tt.pattern)
+		if err != nil {
+			t.Errorf("compileURLPattern(%q): %v", tt.pattern, err)
+			continue
+		}
+		if got := m.MatchString(tt.url); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.url, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", `*/trailing\`} {
+		if _, err := compileURLPattern(bad); err == nil {
+			t.Errorf("compileURLPattern(%q) should fail", bad)
+		}
+	}
+}
+
+func TestURLPatternValidation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Browser.Blocking.URLPatterns = []string{"*/(unbalanced*", `*/bad\`}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "browser.blocking.urlPatterns[1]") || strings.Contains(err.Error(), "urlPatterns[0]") {
+		t.Errorf("expected only the unfinished escape to be rejected, got %v", err)
+	}
+	if _, err := compileURLPatterns(DefaultConfig().Browser.Blocking.URLPatterns); err != nil {
+		t.Errorf("default patterns: %v", err)
+	}
+}
+
+func TestBlockRequestsInBrowser(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/post":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><link rel="stylesheet" href="/style.css"><script src="/tracker.js"></script></head>
+<body><img src="/photo.jpg"><script src="/app.js"></script></body></html>`))
+		default:
+			w.Write(nil)
+		}
+	}))
+	defer srv.Close()
+
+	te := newTestExtractor(t, srv)
+	te.cfg.Browser.Blocking = BlockingConfig{
+		Enabled:       true,
+		ResourceTypes: []string{"Stylesheet", "Image"},
+		URLPatterns:   []string{"*/tracker.js"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	page, blocked, release, err := te.acquirePage(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	if err := page.Context(ctx).Navigate(srv.URL + "/post"); err != nil {
+		t.Fatal(err)
+	}
+	page.Context(ctx).WaitLoad()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/style.css", "/photo.jpg", "/tracker.js"} {
+		if hits[path] != 0 {
+			t.Errorf("%s reached the server", path)
+		}
+	}
+	if hits["/post"] != 1 || hits["/app.js"] != 1 {
+		t.Errorf("page or app script not loaded: %v", hits)
+	}
+	if blocked.count() != 3 {
+		t.Errorf("blocked %d requests, want 3", blocked.count())
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// extractionCache keeps recent extraction results so a bundle can be built from
+// an extractionId without running the browser again
+type extractionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]cachedExtraction
+	order   []string // insertion order, oldest first
+}
+
+type cachedExtraction struct {
+	postURL string
+	result  *ExtractResponse
+	expires time.Time
+}
+
+func newExtractionCache(ttl time.Duration, max int) *extractionCache {
+	return &extractionCache{ttl: ttl, max: max, entries: make(map[string]cachedExtraction)}
+}
+
+// put stores a copy of result under a fresh ID, evicting the oldest entries
+// beyond max. The caller keeps filling in its result after put (extraction ID,
+// archive, timings), so the cache must not share it.
+func (c *extractionCache) put(postURL string, result *ExtractResponse) string {
+	id := newRequestID()
+	result = cloneExtraction(result)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[id] = cachedExtraction{postURL: postURL, result: result, expires: time.Now().Add(c.ttl)}
+	c.order = append(c.order, id)
+	for len(c.order) > c.max {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	return id
+}
+
+// get returns an unexpired result
+func (c *extractionCache) get(id string) (string, *ExtractResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok || time.Now().After(e.expires) {
+		return "", nil, false
+	}
+	return e.postURL, cloneExtraction(e.result), true
+}
+
+// cloneExtraction deep-copies r so that neither copy sees the other's changes
+func cloneExtraction(r *ExtractResponse) *ExtractResponse {
+	if r == nil {
+		return nil
+	}
+	out := *r
+	out.VideoUrls = maps.Clone(r.VideoUrls)
+	out.Metadata = maps.Clone(r.Metadata)
+	out.Items = slices.Clone(r.Items)
+	out.Timings = slices.Clone(r.Timings)
+	if r.Archive != nil {
+		archive := *r.Archive
+		out.Archive = &archive
+	}
+	return &out
+}
+
+// bundleFetchConcurrency bounds the media connections a bundle keeps open
+const bundleFetchConcurrency = 4
+
+// BundleMetadata is the metadata.json written at the end of every bundle
+type BundleMetadata struct {
+	PostURL   string            `json:"postUrl"`
+	VideoID   string            `json:"videoId,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Caption   string            `json:"caption,omitempty"`
+	Duration  int64             `json:"duration,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Items     []BundleItem      `json:"items"`
+	CreatedAt string            `json:"createdAt"`
+}
+
+// BundleItem records what happened to one media item of a bundle
+type BundleItem struct {
+	File      string `json:"file,omitempty"`
+	SourceURL string `json:"sourceUrl"`
+	MediaType string `json:"mediaType"`
+	Bytes     int64  `json:"bytes,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// fetchedItem is an item's open upstream response, or why it failed
+type fetchedItem struct {
+	resp *http.Response
+	err  error
+}
+
+// writeBundle streams a ZIP of result's media to w. Items are fetched
+// concurrently but written in order straight from the upstream connections, so
+// at most bundleFetchConcurrency bodies are in flight and none is buffered.
+// Failed items are listed in metadata.json instead of aborting the archive.
+func writeBundle(ctx context.Context, w io.Writer, fetcher *mediaFetcher, postURL string, result *ExtractResponse) (int64, error) {
+	items := result.Items
+	if len(items) == 0 {
+		items = []MediaItem{{URL: result.MediaURL, MediaType: result.MediaType}}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Slots are taken in item order, so the item the writer waits for has always
+	// been started and the writer can't deadlock on later items holding slots
+	slots := make(chan struct{}, bundleFetchConcurrency)
+	fetched := make([]chan fetchedItem, len(items))
+	for i := range fetched {
+		fetched[i] = make(chan fetchedItem, 1)
+	}
+	go func() {
+		for i, item := range items {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				for _, ch := range fetched[i:] {
+					ch <- fetchedItem{err: ctx.Err()}
+				}
+				return
+			}
+			go func(i int, item MediaItem) {
+				resp, err := fetcher.open(ctx, item.URL)
+				fetched[i] <- fetchedItem{resp: resp, err: err}
+			}(i, item)
+		}
+	}()
+
+	// On an early return, close whatever responses are still queued
+	next := 0
+	defer func() {
+		cancel()
+		go func(pending []chan fetchedItem) {
+			for _, ch := range pending {
+				if got := <-ch; got.resp != nil {
+					got.resp.Body.Close()
+				}
+			}
+		}(fetched[next:])
+	}()
+
+	counter := &countingWriter{w: w}
+	zw := zip.NewWriter(counter)
+	base := path.Base(strings.TrimSuffix(postURL, "/"))
+
+	meta := BundleMetadata{
+		PostURL:   postURL,
+		VideoID:   result.VideoID,
+		Title:     result.Title,
+		Caption:   result.Caption,
+		Duration:  result.Duration,
+		Metadata:  result.Metadata,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if result.Caption != "" {
+		f, err := zw.Create("caption.txt")
+		if err != nil {
+			return counter.n, err
+		}
+		if _, err := io.WriteString(f, result.Caption+"\n"); err != nil {
+			return counter.n, err
+		}
+	}
+
+	for i, item := range items {
+		entry := BundleItem{SourceURL: item.URL, MediaType: item.MediaType}
+		got := <-fetched[i]
+		next = i + 1
+		if got.err != nil {
+			if ctx.Err() != nil {
+				// The request is gone; unstarted items never took a slot, so stop here
+				return counter.n, ctx.Err()
+			}
+			entry.Error = got.err.Error()
+			meta.Items = append(meta.Items, entry)
+			<-slots
+			continue
+		}
+
+		ext := mediaExtension(got.resp.Header.Get("Content-Type"), item.URL)
+		if ext == "" {
+			ext = ".bin"
+		}
+		entry.File = fmt.Sprintf("%s_%02d%s", base, i+1, ext)
+
+		// Media is already compressed, storing it avoids burning CPU for nothing
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: entry.File, Method: zip.Store, Modified: time.Now()})
+		if err == nil {
+			entry.Bytes, err = io.Copy(f, got.resp.Body)
+		}
+		got.resp.Body.Close()
+		<-slots
+		if err != nil {
+			// Either the client or the CDN connection broke; the archive can't be completed
+			return counter.n, err
+		}
+		meta.Items = append(meta.Items, entry)
+	}
+
+	f, err := zw.Create("metadata.json")
+	if err != nil {
+		return counter.n, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(meta); err != nil {
+		return counter.n, err
+	}
+
+	err = zw.Close()
+	return counter.n, err
+}
+
+// countingWriter counts the bytes passed through to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// handleDownloadBundle streams every media item of a post as one ZIP. The post
+// is given either as ?id= (an extractionId from /api/extract) or ?url= (a post
+// URL, extracted on the spot).
+func handleDownloadBundle(te *ThreadsExtractor, cache *extractionCache, cfg DownloadConfig) http.HandlerFunc {
+	fetcher := newMediaFetcher(cfg, te.proxies)
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := loggerFrom(r.Context())
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := r.URL.Query().Get("id")
+		postURL := r.URL.Query().Get("url")
+
+		var result *ExtractResponse
+		switch {
+		case id != "":
+			var ok bool
+			postURL, result, ok = cache.get(id)
+			if !ok {
+				recordError(r)
+				metrics.downloadResponses.Inc(strconv.Itoa(http.StatusNotFound))
+				http.Error(w, "Unknown or expired extraction ID", http.StatusNotFound)
+				return
+			}
+		case postURL != "":
+			var err error
+			result, err = te.extractMediaURL(r.Context(), postURL)
+			if err != nil {
+				if r.Context().Err() != nil {
+					return
+				}
+				logger.Warn("extraction for bundle failed", "url", postURL, "error", err)
+				recordError(r)
+				metrics.downloadResponses.Inc(strconv.Itoa(http.StatusBadRequest))
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			recordExtraction(r)
+			if normalized, err := te.normalizeURL(postURL); err == nil {
+				postURL = normalized
+			}
+		default:
+			recordError(r)
+			metrics.downloadResponses.Inc(strconv.Itoa(http.StatusBadRequest))
+			http.Error(w, "url or id parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		filename := path.Base(strings.TrimSuffix(postURL, "/")) + ".zip"
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+		metrics.downloadResponses.Inc(strconv.Itoa(http.StatusOK))
+
+		written, err := writeBundle(r.Context(), w, fetcher, postURL, result)
+		recordBytesProxied(r, written)
+		metrics.proxiedBytes.Add(float64(written))
+		if err != nil {
+			// Headers are gone already, all we can do is cut the stream short
+			logger.Warn("bundle interrupted", "url", postURL, "bytes", written, "error", err)
+			recordError(r)
+			return
+		}
+
+		logger.Info("streamed bundle", "url", postURL, "items", len(result.Items), "bytes", written)
+	}
+}
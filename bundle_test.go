@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteBundle(t *testing.T) {
+	media := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			io.WriteString(w, "first clip")
+		case "/2.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			io.WriteString(w, "second image")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer media.Close()
+
+	result := &ExtractResponse{
+		MediaURL:  media.URL + "/1.mp4",
+		MediaType: "video",
+		Caption:   "hello from the fixture",
+		Items: []MediaItem{
+			{URL: media.URL + "/1.mp4", MediaType: "video"},
+			{URL: media.URL + "/gone.mp4", MediaType: "video"},
+			{URL: media.URL + "/2.jpg", MediaType: "image"},
+		},
+	}
+
+	var buf bytes.Buffer
+	written, err := writeBundle(context.Background(), &buf, newMediaFetcher(DefaultConfig().Download, nil), "https://www.threads.net/@user/post/ABC", result)
+	if err != nil {
+		t.Fatalf("writeBundle failed: %v", err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("written = %d, buffer holds %d", written, buf.Len())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	files := make(map[string]string)
+	var names []string
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+		names = append(names, f.Name)
+	}
+
+	wantNames := []string{"caption.txt", "ABC_01.mp4", "ABC_03.jpg", "metadata.json"}
+	if len(names) != len(wantNames) {
+		t.Fatalf("zip entries = %v, want %v", names, wantNames)
+	}
+	for i, name := range wantNames {
+		if names[i] != name {
+			t.Errorf("entry %d = %s, want %s", i, names[i], name)
+		}
+	}
+	if files["ABC_01.mp4"] != "first clip" || files["ABC_03.jpg"] != "second image" {
+		t.Errorf("media contents = %q, %q", files["ABC_01.mp4"], files["ABC_03.jpg"])
+	}
+	if files["caption.txt"] != "hello from the fixture\n" {
+		t.Errorf("caption = %q", files["caption.txt"])
+	}
+
+	var meta BundleMetadata
+	if err := json.Unmarshal([]byte(files["metadata.json"]), &meta); err != nil {
+		t.Fatalf("metadata.json: %v", err)
+	}
+	if len(meta.Items) != 3 || meta.Items[1].Error == "" || meta.Items[1].File != "" || meta.Items[2].Bytes != int64(len("second image")) {
+		t.Errorf("metadata items = %+v", meta.Items)
+	}
+}
+
+func TestExtractionCache(t *testing.T) {
+	cache := newExtractionCache(time.Hour, 2)
+
+	first := cache.put("https://www.threads.net/@a/post/1", &ExtractResponse{MediaURL: "one"})
+	second := cache.put("https://www.threads.net/@a/post/2", &ExtractResponse{MediaURL: "two"})
+	if postURL, result, ok := cache.get(second); !ok || result.MediaURL != "two" || postURL != "https://www.threads.net/@a/post/2" {
+		t.Errorf("get(second) = %q, %+v, %v", postURL, result, ok)
+	}
+
+	cache.put("https://www.threads.net/@a/post/3", &ExtractResponse{MediaURL: "three"})
+	if _, _, ok := cache.get(first); ok {
+		t.Error("oldest entry survived past the size limit")
+	}
+
+	expired := newExtractionCache(-time.Second, 10)
+	id := expired.put("https://www.threads.net/@a/post/1", &ExtractResponse{})
+	if _, _, ok := expired.get(id); ok {
+		t.Error("expired entry returned")
+	}
+}
+
+func TestExtractionCacheCopies(t *testing.T) {
+	cache := newExtractionCache(time.Hour, 2)
+	result := &ExtractResponse{
+		MediaURL: "one",
+		Metadata: map[string]string{"author": "a"},
+		Items:    []MediaItem{{URL: "one", MediaType: "video"}},
+	}
+	id := cache.put("https://www.threads.net/@a/post/1", result)
+
+	// The handler keeps filling in its response after put
+	result.ID = id
+	result.Metadata["author"] = "changed"
+	result.Items[0].URL = "changed"
+	result.Archive = &ArchivedMedia{Key: "k"}
+
+	_, cached, _ := cache.get(id)
+	if cached.ID != "" || cached.Metadata["author"] != "a" || cached.Items[0].URL != "one" || cached.Archive != nil {
+		t.Errorf("cached result changed with the caller's: %+v", cached)
+	}
+
+	// Nor do callers of get share it
+	cached.Metadata["author"] = "changed"
+	cached.Items[0].URL = "changed"
+	if _, again, _ := cache.get(id); again.Metadata["author"] != "a" || again.Items[0].URL != "one" {
+		t.Errorf("cached result changed through get: %+v", again)
+	}
+}
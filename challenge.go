@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// Page states Threads serves instead of a post, as detected by detectPageState
+const (
+	pageStateLoginWall   = "login_wall"   // login interstitial in place of the post
+	pageStateErrorPage   = "error_page"   // "Something went wrong" or a 5xx document
+	pageStateRateLimited = "rate_limited" // 429 or a "try again later" notice
+	pageStateUnavailable = "unavailable"  // deleted or private post
+)
+
+// pageStateJS classifies the loaded document, returning an empty string for a
+// page that looks like a post. The document status comes from the navigation
+// timing entry, since rod's Navigate doesn't report it. The wording checks only
+// count when the status isn't 2xx or the page carries no post, so a caption
+// that happens to say "Try again later" doesn't block the session.
+const pageStateJS = `() => {
+	const nav = performance.getEntriesByType('navigation')[0];
+	const status = (nav && nav.responseStatus) || 0;
+	const hasPost = !!document.querySelector('article, video') ||
+		Array.from(document.querySelectorAll('script[type="application/json"]'))
+			.some(s => /"(video_versions|image_versions2|carousel_media)"/.test(s.textContent));
+	const text = (status >= 300 || !hasPost) && document.body ? document.body.innerText : '';
+	if (status === 429 || /Please wait a few minutes before you try again|Too many requests|Try again later/i.test(text)) {
+		return 'rate_limited';
+	}
+	if (status >= 500 || /Something went wrong/i.test(text)) {
+		return 'error_page';
+	}
+	if (status === 404 || /Sorry, this page isn.t available|This post is unavailable/i.test(text)) {
+		return 'unavailable';
+	}
+	if (document.querySelector('#loginForm, form[action*="/accounts/login"], input[name="password"]') ||
+		/^\/(accounts\/)?login/.test(location.pathname)) {
+		return 'login_wall';
+	}
+	return '';
+}`
+
+// pageStateError is returned when Threads served one of the page states
+// instead of the post
+type pageStateError struct {
+	State      string
+	RetryAfter time.Duration // How long the proxy or session backs off, 0 when it doesn't
+}
+
+func (e *pageStateError) Error() string {
+	var msg string
+	switch e.State {
+	case pageStateLoginWall:
+		msg = "Threads showed a login wall instead of the post"
+	case pageStateErrorPage:
+		msg = "Threads served an error page instead of the post"
+	case pageStateRateLimited:
+		msg = "Threads rate limited the request"
+	case pageStateUnavailable:
+		msg = "post is unavailable - it may have been deleted or made private"
+	default:
+		msg = fmt.Sprintf("Threads served an unexpected page (%s)", e.State)
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry in %s", e.RetryAfter.Round(time.Second))
+	}
+	return msg
+}
+
+// blocksSession tells whether the state means Threads is pushing back on the
+// client, as opposed to the post itself being gone
+func blocksSession(state string) bool {
+	return state == pageStateLoginWall || state == pageStateErrorPage || state == pageStateRateLimited
+}
+
+// extractErrorStatus maps an extraction error to the HTTP status and error
+// code /api/extract answers with
+func extractErrorStatus(err error) (int, string) {
+	var stateErr *pageStateError
+	if !errors.As(err, &stateErr) {
+		return http.StatusBadRequest, ""
+	}
+	switch stateErr.State {
+	case pageStateRateLimited:
+		return http.StatusTooManyRequests, stateErr.State
+	case pageStateUnavailable:
+		return http.StatusNotFound, stateErr.State
+	default:
+		return http.StatusServiceUnavailable, stateErr.State
+	}
+}
+
+// setRetryAfter adds a Retry-After header when err carries a backoff
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var stateErr *pageStateError
+	if errors.As(err, &stateErr) && stateErr.RetryAfter > 0 {
+		secs := int((stateErr.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+	}
+}
+
+// detectPageState runs the page state detectors on a loaded page
+func (te *ThreadsExtractor) detectPageState(parent context.Context, page *rod.Page) string {
+	ctx, cancel := context.WithTimeout(parent, te.cfg.Extraction.AnalyzeTimeout.Std())
+	defer cancel()
+
+	res, err := page.Context(ctx).Eval(pageStateJS)
+	if err != nil {
+		loggerFrom(ctx).Debug("page state detection failed", "error", err)
+		return ""
+	}
+	return res.Value.Str()
+}
+
+// blockBackoff tracks how long each proxy, or the direct connection, stays
+// out after Threads blocked it. Every block in a row doubles the wait up to
+// the configured maximum; a clean page resets it. A nil tracker never backs off.
+type blockBackoff struct {
+	base time.Duration
+	max  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*backoffEntry
+}
+
+type backoffEntry struct {
+	blocks int
+	state  string
+	until  time.Time
+}
+
+// directBackoffKey is the backoff key used when no proxy is involved
+const directBackoffKey = "direct"
+
+func newBlockBackoff(cfg ExtractionConfig) *blockBackoff {
+	return &blockBackoff{
+		base:    cfg.BlockBackoff.Std(),
+		max:     cfg.MaxBlockBackoff.Std(),
+		now:     time.Now,
+		entries: make(map[string]*backoffEntry),
+	}
+}
+
+// trip records a block for key and returns how long it backs off
+func (b *blockBackoff) trip(key, state string) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.entries[key]
+	if e == nil {
+		e = &backoffEntry{}
+		b.entries[key] = e
+	}
+	e.blocks++
+	wait := b.base
+	for i := 1; i < e.blocks && wait < b.max; i++ {
+		wait *= 2
+	}
+	wait = min(wait, b.max)
+	e.state = state
+	e.until = b.now().Add(wait)
+	return wait
+}
+
+// reset clears the backoff of key after it got a clean page
+func (b *blockBackoff) reset(key string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	delete(b.entries, key)
+	b.mu.Unlock()
+}
+
+// active returns the state that blocked key and how much of its backoff is
+// left, or a zero duration when key may be used
+func (b *blockBackoff) active(key string) (string, time.Duration) {
+	if b == nil {
+		return "", 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.entries[key]
+	if e == nil {
+		return "", 0
+	}
+	remaining := e.until.Sub(b.now())
+	if remaining <= 0 {
+		return "", 0
+	}
+	return e.state, remaining
+}
+
+// backoffKey identifies the client a request went out as
+func backoffKey(proxy *upstreamProxy) string {
+	if proxy == nil {
+		return directBackoffKey
+	}
+	return proxy.label
+}
+
+// pageStateFailure turns a detected page state into the extraction error.
+// Blocking states back off the proxy (or the direct connection) and start a
+// new profile session, so the next attempt looks like a different client.
+func (te *ThreadsExtractor) pageStateFailure(ctx context.Context, state string, proxy *upstreamProxy) error {
+	metrics.blockedPages.Inc(state)
+	if !blocksSession(state) {
+		return &pageStateError{State: state}
+	}
+
+	wait := te.blocks.trip(backoffKey(proxy), state)
+	te.proxies.penalize(proxy, wait)
+	te.profiles.newSession()
+	loggerFrom(ctx).Warn("Threads blocked the request, backing off", "state", state, "proxy", backoffKey(proxy), "backoff", wait.String())
+	return &pageStateError{State: state, RetryAfter: wait}
+}
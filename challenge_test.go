@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlockBackoff(t *testing.T) {
+	cfg := DefaultConfig().Extraction
+	cfg.BlockBackoff = Duration(10 * time.Second)
+	cfg.MaxBlockBackoff = Duration(35 * time.Second)
+	b := newBlockBackoff(cfg)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	for _, want := range []time.Duration{10 * time.Second, 20 * time.Second, 35 * time.Second, 35 * time.Second} {
+		if got := b.trip("proxy:1", pageStateRateLimited); got != want {
+			t.Errorf("trip = %v, want %v", got, want)
+		}
+	}
+	if state, wait := b.active("proxy:1"); state != pageStateRateLimited || wait != 35*time.Second {
+		t.Errorf("active = %q %v", state, wait)
+	}
+	if _, wait := b.active("proxy:2"); wait != 0 {
+		t.Errorf("untouched key backs off for %v", wait)
+	}
+
+	now = now.Add(time.Minute)
+	if _, wait := b.active("proxy:1"); wait != 0 {
+		t.Errorf("backoff should be over, %v left", wait)
+	}
+
+	b.reset("proxy:1")
+	if got := b.trip("proxy:1", pageStateLoginWall); got != 10*time.Second {
+		t.Errorf("trip after reset = %v, want the base backoff", got)
+	}
+
+	var nilBackoff *blockBackoff
+	if nilBackoff.trip("x", pageStateRateLimited) != 0 {
+		t.Error("nil backoff should never back off")
+	}
+}
+
+func TestExtractErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{errors.New("unable to find media URLs"), http.StatusBadRequest, ""},
+		{&pageStateError{State: pageStateRateLimited}, http.StatusTooManyRequests, "rate_limited"},
+		{&pageStateError{State: pageStateLoginWall}, http.StatusServiceUnavailable, "login_wall"},
+		{&pageStateError{State: pageStateErrorPage}, http.StatusServiceUnavailable, "error_page"},
+		{fmt.Errorf("wrapped: %w", &pageStateError{State: pageStateUnavailable}), http.StatusNotFound, "unavailable"},
+	}
+	for _, tt := range tests {
+		status, code := extractErrorStatus(tt.err)
+		if status != tt.status || code != tt.code {
+			t.Errorf("extractErrorStatus(%v) = %d %q, want %d %q", tt.err, status, code, tt.status, tt.code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	setRetryAfter(w, &pageStateError{State: pageStateRateLimited, RetryAfter: 1500 * time.Millisecond})
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+}
+
+func TestPageStateFailureBacksOff(t *testing.T) {
+	cfg := DefaultConfig()
+	pool, _ := newTestProxyPool(t, "http://a:1", "http://b:2")
+	te := &ThreadsExtractor{
+		cfg:      cfg,
+		profiles: newProfileRotator(cfg.Browser),
+		proxies:  pool,
+		blocks:   newBlockBackoff(cfg.Extraction),
+	}
+	proxy := pool.pick("post")
+
+	err := te.pageStateFailure(context.Background(), pageStateRateLimited, proxy)
+	var stateErr *pageStateError
+	if !errors.As(err, &stateErr) || stateErr.RetryAfter != cfg.Extraction.BlockBackoff.Std() {
+		t.Fatalf("err = %v", err)
+	}
+	if !strings.Contains(err.Error(), "rate limited") || !strings.Contains(err.Error(), "retry in 30s") {
+		t.Errorf("message = %q", err)
+	}
+	if got := pool.pick("post"); got == proxy {
+		t.Error("blocked proxy kept the post")
+	}
+
+	// A deleted post says nothing about the client
+	err = te.pageStateFailure(context.Background(), pageStateUnavailable, nil)
+	if !errors.As(err, &stateErr) || stateErr.RetryAfter != 0 {
+		t.Errorf("unavailable post should not back off: %v", err)
+	}
+	if _, wait := te.blocks.active(directBackoffKey); wait != 0 {
+		t.Error("direct connection backs off after an unavailable post")
+	}
+}
+
+func TestDetectPageState(t *testing.T) {
+	pages := map[string]struct {
+		status int
+		body   string
+	}{
+		"/post":    {http.StatusOK, `<html><body><video src="https://scontent.cdninstagram.com/v/clip.mp4"></video></body></html>`},
+		"/login":   {http.StatusOK, `<html><body><form id="loginForm"><input name="password" type="password"></form></body></html>`},
+		"/oops":    {http.StatusOK, `<html><body><h1>Something went wrong</h1></body></html>`},
+		"/busy":    {http.StatusTooManyRequests, `<html><body>Please wait a few minutes before you try again.</body></html>`},
+		"/crashed": {http.StatusBadGateway, `<html><body>Bad gateway</body></html>`},
+		"/gone":    {http.StatusOK, `<html><body>Sorry, this page isn't available.</body></html>`},
+		"/caption": {http.StatusOK, `<html><body><article><p>Try again later, something went wrong</p><video src="https://scontent.cdninstagram.com/v/clip.mp4"></video></article></body></html>`},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(p.status)
+		w.Write([]byte(p.body))
+	}))
+	defer srv.Close()
+
+	te := newTestExtractor(t, srv)
+
+	tests := map[string]string{
+		"/post":    "",
+		"/login":   pageStateLoginWall,
+		"/oops":    pageStateErrorPage,
+		"/busy":    pageStateRateLimited,
+		"/crashed": pageStateErrorPage,
+		"/gone":    pageStateUnavailable,
+		"/caption": "",
+	}
+	for path, want := range tests {
+		t.Run(path, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			page, _, release, err := te.acquirePage(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			if err := page.Context(ctx).Navigate(srv.URL + path); err != nil {
+				t.Fatal(err)
+			}
+			page.Context(ctx).WaitLoad()
+			if got := te.detectPageState(ctx, page); got != want {
+				t.Errorf("state = %q, want %q", got, want)
+			}
+		})
+	}
+}
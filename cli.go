@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+// errConfigPrinted is returned by commandConfig after -print-config wrote the
+// configuration; the command should exit successfully without doing anything
+var errConfigPrinted = errors.New("configuration printed")
+
+// commandConfig parses a subcommand's arguments, resolves the shared
+// configuration and sets up logging. Subcommand-specific flags must already be
+// registered on fs.
+func commandConfig(fs *flag.FlagSet, cf *configFlags, args []string) (*Config, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg, err := cf.resolve(fs, os.Getenv)
+	if err != nil {
+		return nil, fmt.Errorf("configuration error: %v", err)
+	}
+
+	if err := setupLogging(cfg.Log, os.Stderr); err != nil {
+		return nil, fmt.Errorf("logging setup error: %v", err)
+	}
+
+	if cf.printConfig {
+		if err := cfg.WriteYAML(os.Stdout); err != nil {
+			return nil, fmt.Errorf("failed to print config: %v", err)
+		}
+		return nil, errConfigPrinted
+	}
+	return cfg, nil
+}
+
+// signalContext is cancelled on SIGINT or SIGTERM so a command can stop its
+// current work and still close the browser
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// transcodeFlags are the CLI counterparts of the /api/download processing parameters
+type transcodeFlags struct {
+	format string
+	start  string
+	end    string
+	height int
+}
+
+// registerTranscodeFlags adds the media processing flags to fs
+func registerTranscodeFlags(fs *flag.FlagSet) *transcodeFlags {
+	tf := &transcodeFlags{}
+	fs.StringVar(&tf.format, "convert", "", "convert downloads with ffmpeg: mp4, m4a (audio only) or gif")
+	fs.StringVar(&tf.start, "start", "", "trim downloads to start here (seconds, 1m30s or hh:mm:ss)")
+	fs.StringVar(&tf.end, "end", "", "trim downloads to end here")
+	fs.IntVar(&tf.height, "height", 0, "scale converted video or GIF to this height")
+	return tf
+}
+
+// options validates the flags the same way the HTTP parameters are validated
+func (tf *transcodeFlags) options() (TranscodeOptions, error) {
+	q := url.Values{}
+	if tf.format != "" {
+		q.Set("format", tf.format)
+	}
+	if tf.start != "" {
+		q.Set("start", tf.start)
+	}
+	if tf.end != "" {
+		q.Set("end", tf.end)
+	}
+	if tf.height != 0 {
+		q.Set("height", strconv.Itoa(tf.height))
+	}
+	return parseTranscodeOptions(q)
+}
+
+// commandTranscoder returns the transcoder a command needs for opts, failing
+// when processing was requested but ffmpeg is missing
+func commandTranscoder(cfg *Config, opts TranscodeOptions) (*transcoder, error) {
+	if !opts.Active() {
+		return nil, nil
+	}
+	tc := newTranscoder(cfg.FFmpeg)
+	if tc == nil {
+		return nil, fmt.Errorf("ffmpeg not found, install it or set -ffmpeg-path")
+	}
+	return tc, nil
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// manifestEntry records one downloaded post so later runs can skip it
+type manifestEntry struct {
+	File         string    `json:"file"`
+	MediaURL     string    `json:"mediaUrl"`
+	MediaType    string    `json:"mediaType"`
+	Bytes        int64     `json:"bytes"`
+	DownloadedAt time.Time `json:"downloadedAt"`
+}
+
+// downloadManifest is the manifest.json kept in the output directory, keyed by
+// normalized post URL
+type downloadManifest struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]manifestEntry `json:"entries"`
+}
+
+// loadManifest reads the manifest in dir, starting empty if there is none
+func loadManifest(dir string) (*downloadManifest, error) {
+	m := &downloadManifest{
+		path:    filepath.Join(dir, "manifest.json"),
+		Entries: make(map[string]manifestEntry),
+	}
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", m.path, err)
+	}
+	if m.Entries == nil {
+		m.Entries = make(map[string]manifestEntry)
+	}
+	return m, nil
+}
+
+// done reports whether postURL was downloaded and its file is still there
+func (m *downloadManifest) done(postURL string) (manifestEntry, bool) {
+	m.mu.Lock()
+	entry, ok := m.Entries[postURL]
+	m.mu.Unlock()
+	if !ok {
+		return entry, false
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(m.path), entry.File)); err != nil {
+		return entry, false
+	}
+	return entry, true
+}
+
+// add records a download and persists the manifest right away, so an
+// interrupted run loses nothing it already fetched
+func (m *downloadManifest) add(postURL string, entry manifestEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Entries[postURL] = entry
+	tmp := m.path + ".tmp"
+	if err := writeJSONFile(tmp, m); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// readURLList reads post URLs from a plain list (one per line) or a CSV file.
+// For CSV, a header column named "url" is used if present, otherwise the first
+// field that looks like a Threads URL. Blank lines and # comments are ignored.
+func readURLList(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	urlColumn := -1
+	if len(records) > 0 {
+		for i, field := range records[0] {
+			if strings.EqualFold(strings.TrimSpace(field), "url") {
+				urlColumn = i
+				records = records[1:]
+				break
+			}
+		}
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	for _, record := range records {
+		var u string
+		if urlColumn >= 0 {
+			if urlColumn < len(record) {
+				u = strings.TrimSpace(record[urlColumn])
+			}
+		} else {
+			for _, field := range record {
+				if field = strings.TrimSpace(field); strings.Contains(field, "threads.") {
+					u = field
+					break
+				}
+			}
+		}
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// bulkResult is one URL's line in the summary report
+type bulkResult struct {
+	URL      string `json:"url"`
+	Status   string `json:"status"` // "downloaded", "skipped" or "failed"
+	File     string `json:"file,omitempty"`
+	Bytes    int64  `json:"bytes,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// bulkSummary is written to summary.json when a bulk download finishes
+type bulkSummary struct {
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt time.Time    `json:"finishedAt"`
+	Total      int          `json:"total"`
+	Downloaded int          `json:"downloaded"`
+	Skipped    int          `json:"skipped"`
+	Failed     int          `json:"failed"`
+	Results    []bulkResult `json:"results"`
+}
+
+// bulkDownloader extracts and downloads a list of posts
+type bulkDownloader struct {
+	extractor *ThreadsExtractor
+	fetcher   *mediaFetcher
+	manifest  *downloadManifest
+	outDir    string
+	tc        *transcoder
+	transcode TranscodeOptions
+	retries   int
+	timeout   time.Duration
+	backoff   time.Duration
+}
+
+// run processes one URL, retrying extraction and download failures
+func (b *bulkDownloader) run(ctx context.Context, postURL string) bulkResult {
+	res := bulkResult{URL: postURL}
+
+	normalized, err := b.extractor.normalizeURL(postURL)
+	if err != nil {
+		res.Status = "failed"
+		res.Error = err.Error()
+		return res
+	}
+	res.URL = normalized
+
+	if entry, ok := b.manifest.done(normalized); ok {
+		res.Status = "skipped"
+		res.File = entry.File
+		return res
+	}
+
+	for attempt := 1; attempt <= b.retries+1; attempt++ {
+		res.Attempts = attempt
+		if attempt > 1 {
+			if err := sleepContext(ctx, b.backoff*time.Duration(attempt-1)); err != nil {
+				break
+			}
+		}
+
+		var entry manifestEntry
+		entry, err = b.fetch(ctx, normalized)
+		if err == nil {
+			if err := b.manifest.add(normalized, entry); err != nil {
+				slog.Warn("failed to update manifest", "error", err)
+			}
+			res.Status = "downloaded"
+			res.File = entry.File
+			res.Bytes = entry.Bytes
+			res.Error = ""
+			return res
+		}
+		slog.Warn("bulk download attempt failed", "url", normalized, "attempt", attempt, "error", err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	res.Status = "failed"
+	res.Error = err.Error()
+	return res
+}
+
+// fetch runs one extraction and download attempt
+func (b *bulkDownloader) fetch(ctx context.Context, postURL string) (manifestEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	result, err := b.extractor.extractMediaURL(ctx, postURL)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	file := mediaFilename(postURL, result)
+	dest := filepath.Join(b.outDir, file)
+	written, err := b.fetcher.save(ctx, result.MediaURL, dest, nil)
+	if err != nil {
+		return manifestEntry{}, fmt.Errorf("download failed: %v", err)
+	}
+
+	if b.tc != nil {
+		if dest, err = b.tc.transcodeFile(ctx, dest, b.transcode); err != nil {
+			return manifestEntry{}, fmt.Errorf("processing failed: %v", err)
+		}
+		file = filepath.Base(dest)
+		if info, err := os.Stat(dest); err == nil {
+			written = info.Size()
+		}
+	}
+
+	return manifestEntry{
+		File:         file,
+		MediaURL:     result.MediaURL,
+		MediaType:    result.MediaType,
+		Bytes:        written,
+		DownloadedAt: time.Now().UTC(),
+	}, nil
+}
+
+// runDownload implements `threadsvid download`: bulk extraction and download
+// of every post listed in an input file
+func runDownload(args []string) int {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	cf := registerConfigFlags(fs)
+	input := fs.String("i", "", "file with post URLs, one per line or CSV (- for stdin)")
+	outDir := fs.String("o", ".", "output directory for media, manifest.json and summary.json")
+	concurrency := fs.Int("c", 4, "posts processed concurrently (capped by browser.maxPages)")
+	retries := fs.Int("retries", 2, "retries per post after the first attempt")
+	timeout := fs.Duration("timeout", 90*time.Second, "time limit per attempt, extraction and download together")
+	tf := registerTranscodeFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s download -i urls.txt -o ./out [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	cfg, err := commandConfig(fs, cf, args)
+	if errors.Is(err, errConfigPrinted) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *input == "" || fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if *concurrency < 1 || *retries < 0 {
+		fmt.Fprintln(os.Stderr, "download: -c must be at least 1 and -retries not negative")
+		return 2
+	}
+	opts, err := tf.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "download: %v\n", err)
+		return 2
+	}
+	tc, err := commandTranscoder(cfg, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "download: %v\n", err)
+		return 2
+	}
+	if *concurrency > cfg.Browser.MaxPages {
+		*concurrency = cfg.Browser.MaxPages
+	}
+
+	var in io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "download: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	urls, err := readURLList(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "download: failed to read %s: %v\n", *input, err)
+		return 1
+	}
+	if len(urls) == 0 {
+		fmt.Fprintf(os.Stderr, "download: no URLs in %s\n", *input)
+		return 1
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "download: %v\n", err)
+		return 1
+	}
+	manifest, err := loadManifest(*outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "download: %v\n", err)
+		return 1
+	}
+
+	extractor, err := NewThreadsExtractor(cfg)
+	if err != nil {
+		slog.Error("failed to initialize Threads extractor", "error", err)
+		return 1
+	}
+	defer extractor.Close()
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	b := &bulkDownloader{
+		extractor: extractor,
+		fetcher:   newMediaFetcher(cfg.Download, extractor.proxies),
+		manifest:  manifest,
+		outDir:    *outDir,
+		tc:        tc,
+		transcode: opts,
+		retries:   *retries,
+		timeout:   *timeout,
+		backoff:   2 * time.Second,
+	}
+
+	summary := bulkSummary{StartedAt: time.Now().UTC(), Total: len(urls)}
+	results := make([]bulkResult, len(urls))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var progressMu sync.Mutex
+	finished := 0
+
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = b.run(ctx, urls[i])
+
+				progressMu.Lock()
+				finished++
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s %s\n", finished, len(urls), results[i].Status, results[i].URL)
+				progressMu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for i := range urls {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, res := range results {
+		if res.Status == "" {
+			// Never started because the run was interrupted
+			res = bulkResult{URL: urls[i], Status: "failed", Error: "interrupted"}
+			results[i] = res
+		}
+		switch res.Status {
+		case "downloaded":
+			summary.Downloaded++
+		case "skipped":
+			summary.Skipped++
+		default:
+			summary.Failed++
+		}
+	}
+	summary.Results = results
+	summary.FinishedAt = time.Now().UTC()
+
+	if err := writeJSONFile(filepath.Join(*outDir, "summary.json"), summary); err != nil {
+		slog.Error("failed to write summary", "error", err)
+	}
+	printBulkSummary(os.Stdout, summary)
+
+	if summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printBulkSummary writes the failures and totals of a bulk run
+func printBulkSummary(w io.Writer, s bulkSummary) {
+	if s.Failed > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FAILED URL\tATTEMPTS\tERROR")
+		for _, r := range s.Results {
+			if r.Status == "failed" {
+				fmt.Fprintf(tw, "%s\t%d\t%s\n", r.URL, r.Attempts, r.Error)
+			}
+		}
+		tw.Flush()
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d URLs: %d downloaded, %d skipped, %d failed in %s\n",
+		s.Total, s.Downloaded, s.Skipped, s.Failed, s.FinishedAt.Sub(s.StartedAt).Round(time.Second))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadURLList(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name: "plain lines",
+			input: "https://www.threads.net/@a/post/A1\n\n# a comment\n" +
+				"https://www.threads.net/@b/post/B2\nhttps://www.threads.net/@a/post/A1\n",
+			want: []string{"https://www.threads.net/@a/post/A1", "https://www.threads.net/@b/post/B2"},
+		},
+		{
+			name:  "csv with url header",
+			input: "id,url,note\n1,https://www.threads.net/@a/post/A1,first\n2,https://www.threads.net/@b/post/B2,\"x, y\"\n",
+			want:  []string{"https://www.threads.net/@a/post/A1", "https://www.threads.net/@b/post/B2"},
+		},
+		{
+			name:  "csv without header",
+			input: "first,https://www.threads.net/@a/post/A1\nsecond,https://threads.com/@b/post/B2\n",
+			want:  []string{"https://www.threads.net/@a/post/A1", "https://threads.com/@b/post/B2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readURLList(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("readURLList failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readURLList = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadManifest(t *testing.T) {
+	dir := t.TempDir()
+	post := "https://www.threads.net/@a/post/A1"
+
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatalf("loadManifest on empty dir: %v", err)
+	}
+	if _, ok := m.done(post); ok {
+		t.Fatal("empty manifest reports a download")
+	}
+
+	if err := m.add(post, manifestEntry{File: "A1.mp4", Bytes: 3, DownloadedAt: time.Now()}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	// The entry only counts while its file exists
+	reloaded, err := loadManifest(dir)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if _, ok := reloaded.done(post); ok {
+		t.Error("manifest entry without a file counts as done")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "A1.mp4"), []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := reloaded.done(post)
+	if !ok || entry.File != "A1.mp4" || entry.Bytes != 3 {
+		t.Errorf("done = %+v, %v; want the recorded entry", entry, ok)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// extractOutcome is the CLI's record of one URL
+type extractOutcome struct {
+	url    string
+	result *ExtractResponse
+	err    error
+	file   string
+}
+
+// runExtract implements `threadsvid extract`: it runs the extractor on each URL
+// and prints the results, optionally downloading the media
+func runExtract(args []string) int {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	cf := registerConfigFlags(fs)
+	format := fs.String("format", "json", "output format: json or table")
+	outDir := fs.String("o", "", "download the media into this directory")
+	timeout := fs.Duration("timeout", 60*time.Second, "time limit per URL")
+	quiet := fs.Bool("q", false, "don't print download progress")
+	tf := registerTranscodeFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s extract [flags] <threads post URL>...\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	cfg, err := commandConfig(fs, cf, args)
+	if errors.Is(err, errConfigPrinted) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *format != "json" && *format != "table" {
+		fmt.Fprintf(os.Stderr, "extract: unknown format %q, use json or table\n", *format)
+		return 2
+	}
+	opts, err := tf.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "extract: %v\n", err)
+		return 2
+	}
+	if opts.Active() && *outDir == "" {
+		fmt.Fprintln(os.Stderr, "extract: -convert, -start, -end and -height need -o")
+		return 2
+	}
+	tc, err := commandTranscoder(cfg, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "extract: %v\n", err)
+		return 2
+	}
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "extract: %v\n", err)
+			return 1
+		}
+	}
+
+	extractor, err := NewThreadsExtractor(cfg)
+	if err != nil {
+		slog.Error("failed to initialize Threads extractor", "error", err)
+		return 1
+	}
+	defer extractor.Close()
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	fetcher := newMediaFetcher(cfg.Download, extractor.proxies)
+	var outcomes []extractOutcome
+	for _, postURL := range fs.Args() {
+		if ctx.Err() != nil {
+			break
+		}
+
+		o := extractOutcome{url: postURL}
+		urlCtx, cancel := context.WithTimeout(ctx, *timeout)
+		o.result, o.err = extractor.extractMediaURL(urlCtx, postURL)
+		cancel()
+
+		if o.err == nil && *outDir != "" {
+			o.file = filepath.Join(*outDir, mediaFilename(postURL, o.result))
+			var progress func(written, total int64)
+			if !*quiet {
+				progress = progressPrinter(os.Stderr, filepath.Base(o.file))
+			}
+			if _, err := fetcher.save(ctx, o.result.MediaURL, o.file, progress); err != nil {
+				o.err = fmt.Errorf("download failed: %v", err)
+				o.file = ""
+			}
+			if !*quiet {
+				fmt.Fprintln(os.Stderr)
+			}
+			if o.err == nil && tc != nil {
+				if o.file, err = tc.transcodeFile(ctx, o.file, opts); err != nil {
+					o.err = fmt.Errorf("processing failed: %v", err)
+				}
+			}
+		}
+
+		if *format == "json" {
+			printExtractJSON(os.Stdout, o)
+		}
+		outcomes = append(outcomes, o)
+	}
+
+	if *format == "table" {
+		printExtractTable(os.Stdout, outcomes, *outDir != "")
+	}
+
+	for _, o := range outcomes {
+		if o.err != nil {
+			return 1
+		}
+	}
+	if len(outcomes) < fs.NArg() {
+		return 1
+	}
+	return 0
+}
+
+// printExtractJSON writes the same body /api/extract would answer with
+func printExtractJSON(w io.Writer, o extractOutcome) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if o.err != nil {
+		enc.Encode(ErrorResponse{Error: o.err.Error(), Success: false})
+		return
+	}
+	enc.Encode(o.result)
+}
+
+// printExtractTable writes one row per URL
+func printExtractTable(w io.Writer, outcomes []extractOutcome, withFiles bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	header := "URL\tTYPE\tVIDEO ID\tDURATION\tMEDIA URL / ERROR"
+	if withFiles {
+		header += "\tFILE"
+	}
+	fmt.Fprintln(tw, header)
+
+	for _, o := range outcomes {
+		var mediaType, detail string
+		videoID, duration := "-", "-"
+		if o.err != nil {
+			mediaType = "error"
+			detail = o.err.Error()
+		} else {
+			mediaType = o.result.MediaType
+			if o.result.VideoID != "" {
+				videoID = o.result.VideoID
+			}
+			if o.result.Duration > 0 {
+				duration = strconv.FormatInt(o.result.Duration, 10) + "s"
+			}
+			detail = o.result.MediaURL
+		}
+
+		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", o.url, mediaType, videoID, duration, detail)
+		if withFiles {
+			file := o.file
+			if file == "" {
+				file = "-"
+			}
+			row += "\t" + file
+		}
+		fmt.Fprintln(tw, row)
+	}
+}
+
+// progressPrinter returns a progress callback that redraws a single status line
+func progressPrinter(w io.Writer, name string) func(written, total int64) {
+	return func(written, total int64) {
+		if total > 0 {
+			fmt.Fprintf(w, "\r%s  %s / %s (%d%%)", name, formatBytes(written), formatBytes(total), written*100/total)
+		} else {
+			fmt.Fprintf(w, "\r%s  %s", name, formatBytes(written))
+		}
+	}
+}
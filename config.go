@@ -0,0 +1,752 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration that reads and writes as a Go duration string ("15s")
+type Duration time.Duration
+
+// UnmarshalText parses a Go duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a Go duration string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Std returns the duration as a time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// Config is the full server configuration
+type Config struct {
+	Server         ServerConfig     `yaml:"server" json:"server"`
+	Browser        BrowserConfig    `yaml:"browser" json:"browser"`
+	Extraction     ExtractionConfig `yaml:"extraction" json:"extraction"`
+	Download       DownloadConfig   `yaml:"download" json:"download"`
+	Proxies        ProxyConfig      `yaml:"proxies" json:"proxies"`
+	DebugArtifacts DebugConfig      `yaml:"debugArtifacts" json:"debugArtifacts"`
+	FFmpeg         FFmpegConfig     `yaml:"ffmpeg" json:"ffmpeg"`
+	Auth           AuthConfig       `yaml:"auth" json:"auth"`
+	Storage        StorageConfig    `yaml:"storage" json:"storage"`
+	CORS           CORSConfig       `yaml:"cors" json:"cors"`
+	Log            LogConfig        `yaml:"log" json:"log"`
+	Tracing        TracingConfig    `yaml:"tracing" json:"tracing"`
+}
+
+// ServerConfig controls the HTTP listener
+type ServerConfig struct {
+	Host             string   `yaml:"host" json:"host"`
+	Port             int      `yaml:"port" json:"port"`
+	StaticDir        string   `yaml:"staticDir" json:"staticDir"`               // Directory served at "/" (empty disables); must not hold any data files
+	ShutdownTimeout  Duration `yaml:"shutdownTimeout" json:"shutdownTimeout"`   // How long to drain in-flight requests on SIGTERM
+	ReadinessTimeout Duration `yaml:"readinessTimeout" json:"readinessTimeout"` // Budget for all /readyz component checks
+}
+
+// BrowserConfig controls how Chromium is launched and how pages are set up
+type BrowserConfig struct {
+	ChromePath     string         `yaml:"chromePath" json:"chromePath"` // Auto-detected when empty
+	Proxy          string         `yaml:"proxy" json:"proxy"`           // Single upstream proxy, used when proxies.urls is empty
+	Headless       bool           `yaml:"headless" json:"headless"`
+	LauncherFlags  []string       `yaml:"launcherFlags" json:"launcherFlags"`   // "name" or "name=value"
+	UserAgent      string         `yaml:"userAgent" json:"userAgent"`           // Pins a single profile with the viewport below; rotates profiles when empty
+	ViewportWidth  int            `yaml:"viewportWidth" json:"viewportWidth"`   // Only used with userAgent
+	ViewportHeight int            `yaml:"viewportHeight" json:"viewportHeight"` // Only used with userAgent
+	DeviceScale    float64        `yaml:"deviceScale" json:"deviceScale"`       // Only used with userAgent
+	Profiles       ProfilesConfig `yaml:"profiles" json:"profiles"`
+	MaxPages       int            `yaml:"maxPages" json:"maxPages"` // Concurrent extraction pages; more requests queue
+	Blocking       BlockingConfig `yaml:"blocking" json:"blocking"`
+}
+
+// ExtractionConfig holds the timeouts and waits used by extractMediaURL
+type ExtractionConfig struct {
+	HTTPFirst         bool        `yaml:"httpFirst" json:"httpFirst"`                 // Try a plain HTTP fetch before opening a browser page
+	HTTPTimeout       Duration    `yaml:"httpTimeout" json:"httpTimeout"`             // Both HTTP fetches together
+	EmbedFallback     bool        `yaml:"embedFallback" json:"embedFallback"`         // Let the browser retry on the post's /embed page
+	NavigationTimeout Duration    `yaml:"navigationTimeout" json:"navigationTimeout"` // Navigation, load and element waiting
+	NetworkIdle       Duration    `yaml:"networkIdle" json:"networkIdle"`             // Quiet period that counts as the page being loaded
+	AnalyzeTimeout    Duration    `yaml:"analyzeTimeout" json:"analyzeTimeout"`       // analyzePageContent
+	MetaTagTimeout    Duration    `yaml:"metaTagTimeout" json:"metaTagTimeout"`       // extractFromMetaTags
+	DOMTimeout        Duration    `yaml:"domTimeout" json:"domTimeout"`               // extractFromDOMElements
+	SourceTimeout     Duration    `yaml:"sourceTimeout" json:"sourceTimeout"`         // extractFromSourceCode
+	FallbackTimeout   Duration    `yaml:"fallbackTimeout" json:"fallbackTimeout"`     // fallbackExtraction
+	BlockBackoff      Duration    `yaml:"blockBackoff" json:"blockBackoff"`           // First backoff after a login wall, error page or rate limit
+	MaxBlockBackoff   Duration    `yaml:"maxBlockBackoff" json:"maxBlockBackoff"`     // Cap for the backoff, which doubles per block in a row
+	Retry             RetryConfig `yaml:"retry" json:"retry"`
+}
+
+// DownloadConfig controls the media download proxy
+type DownloadConfig struct {
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+}
+
+// StorageConfig selects where archive mode stores media
+type StorageConfig struct {
+	Backend string             `yaml:"backend" json:"backend"` // "" (archive mode off), "local" or "s3"
+	Local   LocalStorageConfig `yaml:"local" json:"local"`
+	S3      S3StorageConfig    `yaml:"s3" json:"s3"`
+}
+
+// LocalStorageConfig stores media on the local filesystem
+type LocalStorageConfig struct {
+	Dir     string `yaml:"dir" json:"dir"`
+	BaseURL string `yaml:"baseUrl" json:"baseUrl"` // Public URL prefix; files are served by this server under it
+}
+
+// S3StorageConfig stores media in an S3-compatible bucket
+type S3StorageConfig struct {
+	Endpoint        string `yaml:"endpoint" json:"endpoint"` // e.g. https://s3.us-east-1.amazonaws.com or http://minio:9000
+	Region          string `yaml:"region" json:"region"`
+	Bucket          string `yaml:"bucket" json:"bucket"`
+	AccessKeyID     string `yaml:"accessKeyId" json:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey" json:"secretAccessKey"`
+	PathStyle       bool   `yaml:"pathStyle" json:"pathStyle"`     // endpoint/bucket/key instead of bucket.endpoint/key, needed by most non-AWS servers
+	PublicURL       string `yaml:"publicUrl" json:"publicUrl"`     // Prefix for returned URLs, e.g. a CDN in front of the bucket
+	Prefix          string `yaml:"prefix" json:"prefix,omitempty"` // Key prefix inside the bucket
+}
+
+// AuthConfig controls API key authentication
+type AuthConfig struct {
+	KeysFile string `yaml:"keysFile" json:"keysFile"` // Empty disables authentication
+}
+
+// DefaultConfig returns the built-in configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Host:             "0.0.0.0",
+			Port:             8080,
+			StaticDir:        ".",
+			ShutdownTimeout:  Duration(30 * time.Second),
+			ReadinessTimeout: Duration(5 * time.Second),
+		},
+		Browser: BrowserConfig{
+			Headless: true,
+			LauncherFlags: []string{
+				"disable-gpu",
+				"disable-dev-shm-usage",
+				"disable-background-timer-throttling",
+				"disable-backgrounding-occluded-windows",
+				"disable-renderer-backgrounding",
+				"disable-features=TranslateUI",
+				"disable-ipc-flooding-protection",
+			},
+			ViewportWidth:  1920,
+			ViewportHeight: 1080,
+			DeviceScale:    1,
+			Profiles: ProfilesConfig{
+				Rotation: "request",
+			},
+			Blocking: BlockingConfig{
+				Enabled:       true,
+				ResourceTypes: []string{"Font", "Stylesheet", "Image", "Media"},
+				URLPatterns: []string{
+					"*google-analytics.com*",
+					"*googletagmanager.com*",
+					"*doubleclick.net*",
+					"*connect.facebook.net*",
+				},
+			},
+			MaxPages: 8,
+		},
+		Extraction: ExtractionConfig{
+			HTTPFirst:         true,
+			HTTPTimeout:       Duration(5 * time.Second),
+			EmbedFallback:     true,
+			NavigationTimeout: Duration(15 * time.Second),
+			NetworkIdle:       Duration(500 * time.Millisecond),
+			AnalyzeTimeout:    Duration(3 * time.Second),
+			MetaTagTimeout:    Duration(2 * time.Second),
+			DOMTimeout:        Duration(5 * time.Second),
+			SourceTimeout:     Duration(2 * time.Second),
+			FallbackTimeout:   Duration(2 * time.Second),
+			BlockBackoff:      Duration(30 * time.Second),
+			MaxBlockBackoff:   Duration(10 * time.Minute),
+			Retry: RetryConfig{
+				MaxAttempts:    3,
+				BaseDelay:      Duration(500 * time.Millisecond),
+				MaxDelay:       Duration(4 * time.Second),
+				MaxTotal:       Duration(45 * time.Second),
+				MinAttemptTime: Duration(5 * time.Second),
+				SwitchProxy:    true,
+				SwitchProfile:  true,
+			},
+		},
+		Download: DownloadConfig{
+			Timeout: Duration(30 * time.Second),
+		},
+		Proxies: ProxyConfig{
+			MaxFailures:         3,
+			EjectFor:            Duration(2 * time.Minute),
+			StickyFor:           Duration(10 * time.Minute),
+			HealthCheckURL:      "https://www.threads.net/",
+			HealthCheckInterval: Duration(30 * time.Second),
+		},
+		DebugArtifacts: DebugConfig{
+			Dir:         "debug",
+			MaxCaptures: 100,
+		},
+		FFmpeg: FFmpegConfig{
+			Timeout:       Duration(2 * time.Minute),
+			MaxConcurrent: 2,
+			MaxGIFLength:  Duration(15 * time.Second),
+		},
+		Storage: StorageConfig{
+			Local: LocalStorageConfig{
+				Dir:     "archive",
+				BaseURL: "/media",
+			},
+			S3: S3StorageConfig{
+				Region: "us-east-1",
+			},
+		},
+		CORS: DefaultCORSConfig(),
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			ServiceName:   "threadsvid",
+			BatchSize:     256,
+			FlushInterval: Duration(5 * time.Second),
+		},
+	}
+}
+
+// Addr returns the listen address for the HTTP server
+func (c *Config) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
+}
+
+// loadFile merges a YAML or JSON config file over the current values
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, c)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file extension %q (use .yaml, .yml or .json)", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// applyEnv overrides values from environment variables
+func (c *Config) applyEnv(getenv func(string) string) error {
+	if v := getenv("PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid PORT %q: %v", v, err)
+		}
+		c.Server.Port = port
+	}
+	if v := getenv("CHROME_PATH"); v != "" {
+		c.Browser.ChromePath = v
+	}
+	if v := getenv("HTTP_PROXY"); v != "" {
+		c.Browser.Proxy = v
+	}
+	if v := getenv("PROFILE_ROTATION"); v != "" {
+		c.Browser.Profiles.Rotation = v
+	}
+	if v := getenv("PROXY_URLS"); v != "" {
+		c.Proxies.URLs = nil
+		for _, raw := range strings.Split(v, ",") {
+			if raw = strings.TrimSpace(raw); raw != "" {
+				c.Proxies.URLs = append(c.Proxies.URLs, raw)
+			}
+		}
+	}
+	if v := getenv("DEBUG_ARTIFACTS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid DEBUG_ARTIFACTS %q: %v", v, err)
+		}
+		c.DebugArtifacts.Enabled = b
+	}
+	if v := getenv("DEBUG_ARTIFACTS_DIR"); v != "" {
+		c.DebugArtifacts.Dir = v
+	}
+	if v := getenv("BLOCK_RESOURCES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid BLOCK_RESOURCES %q: %v", v, err)
+		}
+		c.Browser.Blocking.Enabled = b
+	}
+	if v := getenv("API_KEYS_FILE"); v != "" {
+		c.Auth.KeysFile = v
+	}
+	if v := getenv("NAVIGATION_TIMEOUT"); v != "" {
+		if err := c.Extraction.NavigationTimeout.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("invalid NAVIGATION_TIMEOUT %q: %v", v, err)
+		}
+	}
+	if v := getenv("HTTP_FIRST"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid HTTP_FIRST %q: %v", v, err)
+		}
+		c.Extraction.HTTPFirst = b
+	}
+	if v := getenv("EXTRACT_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid EXTRACT_MAX_ATTEMPTS %q: %v", v, err)
+		}
+		c.Extraction.Retry.MaxAttempts = n
+	}
+	if v := getenv("DOWNLOAD_TIMEOUT"); v != "" {
+		if err := c.Download.Timeout.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("invalid DOWNLOAD_TIMEOUT %q: %v", v, err)
+		}
+	}
+	if v := getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if err := c.Server.ShutdownTimeout.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q: %v", v, err)
+		}
+	}
+	if v := getenv("FFMPEG_PATH"); v != "" {
+		c.FFmpeg.Path = v
+	}
+	if v := getenv("STORAGE_BACKEND"); v != "" {
+		c.Storage.Backend = v
+	}
+	if v := getenv("STORAGE_DIR"); v != "" {
+		c.Storage.Local.Dir = v
+	}
+	if v := getenv("S3_ENDPOINT"); v != "" {
+		c.Storage.S3.Endpoint = v
+	}
+	if v := getenv("S3_BUCKET"); v != "" {
+		c.Storage.S3.Bucket = v
+	}
+	if v := getenv("S3_REGION"); v != "" {
+		c.Storage.S3.Region = v
+	}
+	if v := getenv("AWS_ACCESS_KEY_ID"); v != "" {
+		c.Storage.S3.AccessKeyID = v
+	}
+	if v := getenv("AWS_SECRET_ACCESS_KEY"); v != "" {
+		c.Storage.S3.SecretAccessKey = v
+	}
+	if v := getenv("LOG_LEVEL"); v != "" {
+		c.Log.Level = v
+	}
+	if v := getenv("LOG_FORMAT"); v != "" {
+		c.Log.Format = v
+	}
+	if v := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		c.Tracing.Endpoint = v
+	}
+	if v := getenv("OTEL_SERVICE_NAME"); v != "" {
+		c.Tracing.ServiceName = v
+	}
+	if v := getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		c.CORS.AllowedOrigins = splitList(v)
+	}
+	if v := getenv("CORS_ALLOWED_HEADERS"); v != "" {
+		c.CORS.AllowedHeaders = splitList(v)
+	}
+	if v := getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS %q: %v", v, err)
+		}
+		c.CORS.AllowCredentials = b
+	}
+	if v := getenv("CORS_MAX_AGE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid CORS_MAX_AGE %q: %v", v, err)
+		}
+		c.CORS.MaxAge = n
+	}
+	return nil
+}
+
+// Validate checks the configuration for values that would fail at runtime
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("server.port %d is out of range", c.Server.Port))
+	}
+
+	if c.Browser.ChromePath != "" {
+		if _, err := os.Stat(c.Browser.ChromePath); err != nil {
+			problems = append(problems, fmt.Sprintf("browser.chromePath %s: %v", c.Browser.ChromePath, err))
+		}
+	}
+	if c.Browser.Proxy != "" {
+		if err := validateProxyURL(c.Browser.Proxy); err != nil {
+			problems = append(problems, fmt.Sprintf("browser.proxy %s: %v", redactURL(c.Browser.Proxy), err))
+		}
+	}
+	for i, raw := range c.Proxies.URLs {
+		if err := validateProxyURL(raw); err != nil {
+			problems = append(problems, fmt.Sprintf("proxies.urls[%d] %s: %v", i, redactURL(raw), err))
+		}
+	}
+	if c.Proxies.MaxFailures <= 0 {
+		problems = append(problems, "proxies.maxFailures must be positive")
+	}
+	if c.Proxies.HealthCheckInterval < 0 {
+		problems = append(problems, "proxies.healthCheckInterval must not be negative")
+	}
+	if c.Proxies.HealthCheckURL != "" {
+		if u, err := url.Parse(c.Proxies.HealthCheckURL); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("proxies.healthCheckUrl %q is not a valid URL", c.Proxies.HealthCheckURL))
+		}
+	}
+	if c.Browser.ViewportWidth <= 0 || c.Browser.ViewportHeight <= 0 {
+		problems = append(problems, "browser viewport dimensions must be positive")
+	}
+	if c.Browser.DeviceScale <= 0 {
+		problems = append(problems, "browser.deviceScale must be positive")
+	}
+	if r := c.Browser.Profiles.Rotation; r != "request" && r != "session" {
+		problems = append(problems, fmt.Sprintf("browser.profiles.rotation %q must be request or session", r))
+	}
+	for i, p := range c.Browser.Profiles.List {
+		if err := p.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("browser.profiles.list[%d] %s: %v", i, p.Name, err))
+		}
+	}
+	if c.Browser.MaxPages <= 0 {
+		problems = append(problems, "browser.maxPages must be positive")
+	}
+	for _, name := range c.Browser.Blocking.ResourceTypes {
+		if _, ok := blockableTypes[strings.ToLower(name)]; !ok {
+			problems = append(problems, fmt.Sprintf("browser.blocking.resourceTypes: %q is not a resource type that can be blocked", name))
+		}
+	}
+	for i, pattern := range c.Browser.Blocking.URLPatterns {
+		if _, err := compileURLPattern(pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("browser.blocking.urlPatterns[%d] %q: %v", i, pattern, err))
+		}
+	}
+
+	timeouts := map[string]Duration{
+		"extraction.httpTimeout":       c.Extraction.HTTPTimeout,
+		"extraction.navigationTimeout": c.Extraction.NavigationTimeout,
+		"extraction.networkIdle":       c.Extraction.NetworkIdle,
+		"extraction.analyzeTimeout":    c.Extraction.AnalyzeTimeout,
+		"extraction.metaTagTimeout":    c.Extraction.MetaTagTimeout,
+		"extraction.domTimeout":        c.Extraction.DOMTimeout,
+		"extraction.sourceTimeout":     c.Extraction.SourceTimeout,
+		"extraction.fallbackTimeout":   c.Extraction.FallbackTimeout,
+		"extraction.blockBackoff":      c.Extraction.BlockBackoff,
+		"extraction.maxBlockBackoff":   c.Extraction.MaxBlockBackoff,
+		"extraction.retry.baseDelay":   c.Extraction.Retry.BaseDelay,
+		"extraction.retry.maxDelay":    c.Extraction.Retry.MaxDelay,
+		"extraction.retry.maxTotal":    c.Extraction.Retry.MaxTotal,
+		"download.timeout":             c.Download.Timeout,
+		"proxies.ejectFor":             c.Proxies.EjectFor,
+		"proxies.stickyFor":            c.Proxies.StickyFor,
+		"ffmpeg.timeout":               c.FFmpeg.Timeout,
+		"server.shutdownTimeout":       c.Server.ShutdownTimeout,
+		"server.readinessTimeout":      c.Server.ReadinessTimeout,
+	}
+	for name, d := range timeouts {
+		if d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive", name))
+		}
+	}
+	if c.Extraction.MaxBlockBackoff < c.Extraction.BlockBackoff {
+		problems = append(problems, "extraction.maxBlockBackoff must not be less than extraction.blockBackoff")
+	}
+
+	if c.Extraction.Retry.MaxAttempts <= 0 {
+		problems = append(problems, "extraction.retry.maxAttempts must be positive")
+	}
+	if c.Extraction.Retry.MaxDelay < c.Extraction.Retry.BaseDelay {
+		problems = append(problems, "extraction.retry.maxDelay must not be less than extraction.retry.baseDelay")
+	}
+	if c.Extraction.Retry.MinAttemptTime < 0 {
+		problems = append(problems, "extraction.retry.minAttemptTime must not be negative")
+	}
+	if c.DebugArtifacts.Enabled && c.DebugArtifacts.Dir == "" {
+		problems = append(problems, "debugArtifacts.dir is required when debug artifacts are enabled")
+	}
+	if c.DebugArtifacts.MaxCaptures <= 0 {
+		problems = append(problems, "debugArtifacts.maxCaptures must be positive")
+	}
+
+	if c.FFmpeg.Path != "" {
+		if _, err := os.Stat(c.FFmpeg.Path); err != nil {
+			problems = append(problems, fmt.Sprintf("ffmpeg.path %s: %v", c.FFmpeg.Path, err))
+		}
+	}
+	if c.FFmpeg.MaxConcurrent <= 0 {
+		problems = append(problems, "ffmpeg.maxConcurrent must be positive")
+	}
+	if c.FFmpeg.MaxGIFLength < 0 {
+		problems = append(problems, "ffmpeg.maxGifLength must not be negative")
+	}
+
+	if c.Auth.KeysFile != "" {
+		if _, err := os.Stat(c.Auth.KeysFile); err != nil {
+			problems = append(problems, fmt.Sprintf("auth.keysFile %s: %v", c.Auth.KeysFile, err))
+		}
+	}
+
+	switch c.Storage.Backend {
+	case "":
+	case "local":
+		if c.Storage.Local.Dir == "" {
+			problems = append(problems, "storage.local.dir is required for the local backend")
+		}
+	case "s3":
+		if u, err := url.Parse(c.Storage.S3.Endpoint); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("storage.s3.endpoint %q is not a valid URL", c.Storage.S3.Endpoint))
+		}
+		if c.Storage.S3.Bucket == "" {
+			problems = append(problems, "storage.s3.bucket is required for the s3 backend")
+		}
+		if c.Storage.S3.AccessKeyID == "" || c.Storage.S3.SecretAccessKey == "" {
+			problems = append(problems, "storage.s3 credentials are required for the s3 backend")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("storage.backend %q must be empty, local or s3", c.Storage.Backend))
+	}
+
+	// Everything under the static root is public, so no data may live there
+	if c.Server.StaticDir != "" {
+		if c.Storage.Backend == "local" && c.Storage.Local.Dir != "" && pathWithin(c.Server.StaticDir, c.Storage.Local.Dir) {
+			problems = append(problems, fmt.Sprintf("storage.local.dir %s is inside server.staticDir %s, archived files would be served there", c.Storage.Local.Dir, c.Server.StaticDir))
+		}
+		if c.Auth.KeysFile != "" && pathWithin(c.Server.StaticDir, c.Auth.KeysFile) {
+			problems = append(problems, fmt.Sprintf("auth.keysFile %s is inside server.staticDir %s, the API keys would be served there", c.Auth.KeysFile, c.Server.StaticDir))
+		}
+		if c.DebugArtifacts.Enabled && c.DebugArtifacts.Dir != "" && pathWithin(c.Server.StaticDir, c.DebugArtifacts.Dir) {
+			problems = append(problems, fmt.Sprintf("debugArtifacts.dir %s is inside server.staticDir %s, captures would be served there without the admin key", c.DebugArtifacts.Dir, c.Server.StaticDir))
+		}
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1)); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("cors.allowedOrigins entry %q is not an origin", origin))
+		}
+	}
+	if c.CORS.allowsAnyOrigin() && c.CORS.AllowCredentials {
+		problems = append(problems, `cors.allowCredentials can't be combined with "*" in cors.allowedOrigins, it would let any site send credentialed requests`)
+	}
+	if c.CORS.MaxAge < 0 {
+		problems = append(problems, "cors.maxAge must not be negative")
+	}
+
+	if _, err := parseLogLevel(c.Log.Level); err != nil {
+		problems = append(problems, fmt.Sprintf("log.level: %v", err))
+	}
+	if f := strings.ToLower(c.Log.Format); f != "json" && f != "text" {
+		problems = append(problems, fmt.Sprintf("log.format %q must be json or text", c.Log.Format))
+	}
+
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("tracing.endpoint %q is not a valid URL", c.Tracing.Endpoint))
+		}
+		if c.Tracing.BatchSize <= 0 {
+			problems = append(problems, "tracing.batchSize must be positive")
+		}
+		if c.Tracing.FlushInterval <= 0 {
+			problems = append(problems, "tracing.flushInterval must be positive")
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// WriteYAML writes the resolved configuration in YAML form, with secrets redacted
+func (c *Config) WriteYAML(w io.Writer) error {
+	redacted := *c
+	if redacted.Storage.S3.SecretAccessKey != "" {
+		redacted.Storage.S3.SecretAccessKey = "REDACTED"
+	}
+	redacted.Browser.Proxy = redactURL(redacted.Browser.Proxy)
+	if len(c.Proxies.URLs) > 0 {
+		redacted.Proxies.URLs = make([]string, len(c.Proxies.URLs))
+		for i, raw := range c.Proxies.URLs {
+			redacted.Proxies.URLs[i] = redactURL(raw)
+		}
+	}
+	// Collector headers usually carry auth tokens
+	if len(c.Tracing.Headers) > 0 {
+		redacted.Tracing.Headers = make(map[string]string, len(c.Tracing.Headers))
+		for k := range c.Tracing.Headers {
+			redacted.Tracing.Headers[k] = "REDACTED"
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(&redacted)
+}
+
+// pathWithin reports whether p is root or lies under it
+func pathWithin(root, p string) bool {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// redactURL hides the password of a URL with credentials
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// configFlags holds the command-line overrides registered on a FlagSet
+type configFlags struct {
+	configFile        string
+	printConfig       bool
+	host              string
+	port              int
+	chromePath        string
+	ffmpegPath        string
+	proxy             string
+	userAgent         string
+	navigationTimeout time.Duration
+	downloadTimeout   time.Duration
+	shutdownTimeout   time.Duration
+	keysFile          string
+	logLevel          string
+	logFormat         string
+}
+
+// registerConfigFlags adds the shared configuration flags to fs
+func registerConfigFlags(fs *flag.FlagSet) *configFlags {
+	cf := &configFlags{}
+	fs.StringVar(&cf.configFile, "config", "", "path to a YAML or JSON config file (env CONFIG_FILE)")
+	fs.BoolVar(&cf.printConfig, "print-config", false, "print the resolved configuration and exit")
+	fs.StringVar(&cf.host, "host", "", "listen host")
+	fs.IntVar(&cf.port, "port", 0, "listen port (env PORT)")
+	fs.StringVar(&cf.chromePath, "chrome-path", "", "path to Chrome/Chromium (env CHROME_PATH)")
+	fs.StringVar(&cf.ffmpegPath, "ffmpeg-path", "", "path to ffmpeg, enables download processing (env FFMPEG_PATH)")
+	fs.StringVar(&cf.proxy, "proxy", "", "browser proxy URL (env HTTP_PROXY)")
+	fs.StringVar(&cf.userAgent, "user-agent", "", "browser user agent")
+	fs.DurationVar(&cf.navigationTimeout, "navigation-timeout", 0, "page navigation timeout (env NAVIGATION_TIMEOUT)")
+	fs.DurationVar(&cf.downloadTimeout, "download-timeout", 0, "media download timeout (env DOWNLOAD_TIMEOUT)")
+	fs.DurationVar(&cf.shutdownTimeout, "shutdown-timeout", 0, "how long to drain in-flight requests on shutdown (env SHUTDOWN_TIMEOUT)")
+	fs.StringVar(&cf.keysFile, "api-keys-file", "", "path to a JSON API keys file (env API_KEYS_FILE)")
+	fs.StringVar(&cf.logLevel, "log-level", "", "log level: debug, info, warn or error (env LOG_LEVEL)")
+	fs.StringVar(&cf.logFormat, "log-format", "", "log format: json or text (env LOG_FORMAT)")
+	return cf
+}
+
+// resolve builds the configuration with precedence defaults < file < env < flags
+func (cf *configFlags) resolve(fs *flag.FlagSet, getenv func(string) string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	configFile := cf.configFile
+	if configFile == "" {
+		configFile = getenv("CONFIG_FILE")
+	}
+	if configFile != "" {
+		if err := cfg.loadFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(getenv); err != nil {
+		return nil, err
+	}
+
+	// Only flags that were explicitly set override lower layers
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			cfg.Server.Host = cf.host
+		case "port":
+			cfg.Server.Port = cf.port
+		case "chrome-path":
+			cfg.Browser.ChromePath = cf.chromePath
+		case "ffmpeg-path":
+			cfg.FFmpeg.Path = cf.ffmpegPath
+		case "proxy":
+			cfg.Browser.Proxy = cf.proxy
+		case "user-agent":
+			cfg.Browser.UserAgent = cf.userAgent
+		case "navigation-timeout":
+			cfg.Extraction.NavigationTimeout = Duration(cf.navigationTimeout)
+		case "download-timeout":
+			cfg.Download.Timeout = Duration(cf.downloadTimeout)
+		case "shutdown-timeout":
+			cfg.Server.ShutdownTimeout = Duration(cf.shutdownTimeout)
+		case "api-keys-file":
+			cfg.Auth.KeysFile = cf.keysFile
+		case "log-level":
+			cfg.Log.Level = cf.logLevel
+		case "log-format":
+			cfg.Log.Format = cf.logFormat
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// splitList splits a comma-separated list and drops empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resolveTestConfig resolves a configuration from a YAML file, an environment
+// and command-line arguments
+func resolveTestConfig(t *testing.T, file string, env map[string]string, args ...string) (*Config, error) {
+	t.Helper()
+	if file != "" {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cf := registerConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cf.resolve(fs, func(key string) string { return env[key] })
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	file := `
+server:
+  port: 9000
+  host: 127.0.0.1
+extraction:
+  navigationTimeout: 20s
+log:
+  level: warn
+`
+	tests := []struct {
+		name       string
+		file       string
+		env        map[string]string
+		args       []string
+		port       int
+		host       string
+		navTimeout time.Duration
+		logLevel   string
+	}{
+		{"defaults", "", nil, nil, 8080, DefaultConfig().Server.Host, 15 * time.Second, "info"},
+		{"file over defaults", file, nil, nil, 9000, "127.0.0.1", 20 * time.Second, "warn"},
+		{"env over file", file, map[string]string{"PORT": "9100", "NAVIGATION_TIMEOUT": "25s"}, nil, 9100, "127.0.0.1", 25 * time.Second, "warn"},
+		{"flags over env", file, map[string]string{"PORT": "9100", "LOG_LEVEL": "error"}, []string{"-port", "9200", "-log-level", "debug"}, 9200, "127.0.0.1", 20 * time.Second, "debug"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := resolveTestConfig(t, tt.file, tt.env, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Port != tt.port || cfg.Server.Host != tt.host {
+				t.Errorf("server = %s:%d, want %s:%d", cfg.Server.Host, cfg.Server.Port, tt.host, tt.port)
+			}
+			if got := cfg.Extraction.NavigationTimeout.Std(); got != tt.navTimeout {
+				t.Errorf("navigationTimeout = %v, want %v", got, tt.navTimeout)
+			}
+			if cfg.Log.Level != tt.logLevel {
+				t.Errorf("log level = %s, want %s", cfg.Log.Level, tt.logLevel)
+			}
+		})
+	}
+}
+
+func TestConfigFileFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"server": {"port": 9300}}`), 0o644)
+	cfg, err := resolveTestConfig(t, "", map[string]string{"CONFIG_FILE": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9300 {
+		t.Errorf("port = %d, want the CONFIG_FILE value", cfg.Server.Port)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want string
+	}{
+		{"bad env value", "", map[string]string{"PORT": "eighty"}, "invalid PORT"},
+		{"bad env duration", "", map[string]string{"NAVIGATION_TIMEOUT": "soon"}, "invalid NAVIGATION_TIMEOUT"},
+		{"unparsable file", "server: [", nil, "failed to parse config file"},
+		{"port out of range", "server:\n  port: 70000\n", nil, "server.port"},
+		{"non-positive timeout", "extraction:\n  domTimeout: 0s\n", nil, "extraction.domTimeout must be positive"},
+		{"bad log level", "log:\n  level: loud\n", nil, "log.level"},
+		{"bad storage backend", "storage:\n  backend: ftp\n", nil, "storage.backend"},
+		{"archive under the static root", "server:\n  staticDir: .\nstorage:\n  backend: local\n  local:\n    dir: archive\n", nil, "storage.local.dir archive is inside server.staticDir"},
+		{"debug artifacts under the static root", "server:\n  staticDir: .\ndebugArtifacts:\n  enabled: true\n  dir: debug\n", nil, "debugArtifacts.dir debug is inside server.staticDir"},
+		{"keys file under the static root", "server:\n  staticDir: web\nauth:\n  keysFile: web/keys.json\n", nil, "auth.keysFile web/keys.json is inside server.staticDir"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveTestConfig(t, tt.file, tt.env)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathWithin(t *testing.T) {
+	tests := []struct {
+		root, path string
+		want       bool
+	}{
+		{".", "archive", true},
+		{".", ".", true},
+		{"web", "web/keys.json", true},
+		{"web", "./web/../web/media", true},
+		{"web", "archive", false},
+		{"web", "webroot/keys.json", false},
+		{"web", "../keys.json", false},
+		{"/srv/web", "/srv/archive", false},
+		{"/srv", "/srv/web/..data", true},
+	}
+	for _, tt := range tests {
+		if got := pathWithin(tt.root, tt.path); got != tt.want {
+			t.Errorf("pathWithin(%q, %q) = %v, want %v", tt.root, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestConfigValidateCollectsProblems(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Server.Port = 0
+	cfg.Browser.MaxPages = 0
+	cfg.FFmpeg.MaxConcurrent = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"server.port", "browser.maxPages", "ffmpeg.maxConcurrent"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("defaults should validate: %v", err)
+	}
+}
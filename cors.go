@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowedOrigins" json:"allowedOrigins"`     // Exact origins, "https://*.example.com" wildcards, or "*"
+	AllowedMethods   []string `yaml:"allowedMethods" json:"allowedMethods"`     // Methods advertised on preflight
+	AllowedHeaders   []string `yaml:"allowedHeaders" json:"allowedHeaders"`     // Request headers advertised on preflight
+	ExposedHeaders   []string `yaml:"exposedHeaders" json:"exposedHeaders"`     // Response headers readable by the browser
+	AllowCredentials bool     `yaml:"allowCredentials" json:"allowCredentials"` // Sends Access-Control-Allow-Credentials
+	MaxAge           int      `yaml:"maxAge" json:"maxAge"`                     // Preflight cache lifetime in seconds (0 = browser default)
+}
+
+// DefaultCORSConfig returns the policy used when nothing is configured
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"https://threadsvid.com"},
+		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key"},
+		ExposedHeaders: []string{"Content-Disposition", "Content-Length"},
+		MaxAge:         600,
+	}
+}
+
+// originAllowed reports whether the request origin matches the configured policy
+func (c CORSConfig) originAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return false
+	}
+
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+
+		// Wildcard subdomains, e.g. https://*.threadsvid.com
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if !ok {
+			continue
+		}
+		if !strings.EqualFold(scheme, parsed.Scheme) {
+			continue
+		}
+		suffix := "." + strings.ToLower(host)
+		if strings.HasSuffix(strings.ToLower(parsed.Host), suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowsAnyOrigin reports whether the policy lets every origin in
+func (c CORSConfig) allowsAnyOrigin() bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// withCORS applies the CORS policy to a handler and answers preflight requests
+func withCORS(cfg CORSConfig, next http.HandlerFunc) http.HandlerFunc {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	anyOrigin := cfg.allowsAnyOrigin()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		if cfg.originAllowed(origin) {
+			// A public API answers with a literal "*", which browsers never
+			// combine with credentials; listed origins are echoed back
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if cfg.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+			if exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+			}
+		}
+
+		// Handle preflight request
+		if r.Method == "OPTIONS" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if cfg.originAllowed(origin) {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				if cfg.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+	}
+}
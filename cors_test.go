@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	cfg := DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://threadsvid.com", "https://*.example.com"}
+
+	tests := map[string]bool{
+		"https://threadsvid.com":      true,
+		"HTTPS://THREADSVID.COM":      true,
+		"https://app.example.com":     true,
+		"https://a.b.example.com":     true,
+		"https://example.com":         false, // the wildcard needs a subdomain
+		"http://app.example.com":      false,
+		"https://evil-example.com":    false,
+		"https://threadsvid.com.evil": false,
+		"https://other.com":           false,
+		"null":                        false,
+		"":                            false,
+	}
+	for origin, want := range tests {
+		if got := cfg.originAllowed(origin); got != want {
+			t.Errorf("originAllowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestWithCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		method      string
+		origin      string
+		status      int
+		allowOrigin string
+		allowCreds  string
+		preflight   bool // expects Allow-Methods and Allow-Headers
+	}{
+		{"allowed origin", []string{"https://threadsvid.com"}, true, "GET", "https://threadsvid.com", http.StatusOK, "https://threadsvid.com", "true", false},
+		{"rejected origin", []string{"https://threadsvid.com"}, true, "GET", "https://evil.com", http.StatusOK, "", "", false},
+		{"no origin", []string{"https://threadsvid.com"}, false, "GET", "", http.StatusOK, "", "", false},
+		{"preflight", []string{"https://threadsvid.com"}, false, "OPTIONS", "https://threadsvid.com", http.StatusNoContent, "https://threadsvid.com", "", true},
+		{"rejected preflight", []string{"https://threadsvid.com"}, false, "OPTIONS", "https://evil.com", http.StatusNoContent, "", "", false},
+		{"any origin", []string{"*"}, false, "GET", "https://anywhere.com", http.StatusOK, "*", "", false},
+		{"any origin preflight", []string{"*"}, false, "OPTIONS", "https://anywhere.com", http.StatusNoContent, "*", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultCORSConfig()
+			cfg.AllowedOrigins = tt.origins
+			cfg.AllowCredentials = tt.credentials
+			handler := withCORS(cfg, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(tt.method, "/api/extract", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.allowCreds {
+				t.Errorf("Allow-Credentials = %q, want %q", got, tt.allowCreds)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods") != ""; got != tt.preflight {
+				t.Errorf("Allow-Methods present = %v, want %v", got, tt.preflight)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Headers") != ""; got != tt.preflight {
+				t.Errorf("Allow-Headers present = %v, want %v", got, tt.preflight)
+			}
+			if vary := strings.Join(w.Header().Values("Vary"), ","); !strings.Contains(vary, "Origin") {
+				t.Errorf("Vary = %q, want Origin", vary)
+			}
+		})
+	}
+}
+
+func TestCORSValidation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CORS.AllowedOrigins = []string{"*"}
+	cfg.CORS.AllowCredentials = true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "cors.allowCredentials") {
+		t.Errorf("expected the wildcard with credentials to be rejected, got %v", err)
+	}
+
+	cfg.CORS.AllowedOrigins = []string{"threadsvid.com"}
+	cfg.CORS.AllowCredentials = false
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "not an origin") {
+		t.Errorf("expected a bad origin to be rejected, got %v", err)
+	}
+}
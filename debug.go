@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// DebugConfig controls the artifacts saved when a browser extraction fails
+type DebugConfig struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled"`
+	Dir         string `yaml:"dir" json:"dir"`                 // One subdirectory per failed request, named after its request ID
+	MaxCaptures int    `yaml:"maxCaptures" json:"maxCaptures"` // Oldest captures are deleted beyond this many
+}
+
+// Files written for every capture
+const (
+	debugInfoFile       = "info.json"
+	debugScreenshotFile = "screenshot.png"
+	debugHTMLFile       = "page.html"
+	debugConsoleFile    = "console.json"
+	debugNetworkFile    = "network.har"
+)
+
+// DebugCaptureInfo describes a failed extraction; it is the capture's info.json
+type DebugCaptureInfo struct {
+	ID          string   `json:"id"`
+	Time        string   `json:"time"`
+	URL         string   `json:"url"`
+	TargetURL   string   `json:"targetUrl"`
+	Error       string   `json:"error"`
+	ReadySignal string   `json:"readySignal,omitempty"`
+	PageState   string   `json:"pageState,omitempty"`
+	Profile     string   `json:"profile,omitempty"`
+	Proxy       string   `json:"proxy,omitempty"`
+	Attempt     int      `json:"attempt,omitempty"`
+	Files       []string `json:"files,omitempty"`
+}
+
+// consoleEntry is one console message, uncaught exception or browser log entry
+type consoleEntry struct {
+	Time   string `json:"time"`
+	Source string `json:"source"` // console, exception or a Log domain source such as network
+	Level  string `json:"level"`
+	Text   string `json:"text"`
+	URL    string `json:"url,omitempty"`
+}
+
+// debugStore keeps the capture directories; nil when debug capture is off
+type debugStore struct {
+	dir string
+	max int
+	mu  sync.Mutex // serializes writes with pruning
+}
+
+func newDebugStore(cfg DebugConfig) *debugStore {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &debugStore{dir: cfg.Dir, max: cfg.MaxCaptures}
+}
+
+// validCaptureID accepts request IDs that are safe as a single path element
+func validCaptureID(id string) bool {
+	return validRequestID(id) && strings.Trim(id, ".") != ""
+}
+
+// debugCapture watches one extraction page from before navigation, so the
+// console and network logs cover the whole page load
+type debugCapture struct {
+	store   *debugStore
+	network *pageRecorder
+	stop    func()
+
+	mu      sync.Mutex
+	console []consoleEntry
+}
+
+// startDebugCapture starts recording page; it returns nil when debug capture is off
+func (te *ThreadsExtractor) startDebugCapture(ctx context.Context, page *rod.Page) *debugCapture {
+	if te.debug == nil {
+		return nil
+	}
+	dc := &debugCapture{store: te.debug, network: newPageRecorder()}
+	listenCtx, stop := context.WithCancel(ctx)
+	wait := page.Context(listenCtx).EachEvent(
+		dc.network.onRequest,
+		dc.network.onResponse,
+		dc.network.onFinished,
+		dc.network.onFailed,
+		dc.onConsole,
+		dc.onException,
+		dc.onLog,
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wait()
+	}()
+	dc.stop = func() {
+		stop()
+		<-done
+	}
+	return dc
+}
+
+// consoleTime formats a CDP timestamp, in milliseconds since the epoch
+func consoleTime(ts proto.RuntimeTimestamp) string {
+	return time.UnixMilli(0).Add(time.Duration(float64(ts) * float64(time.Millisecond))).UTC().Format(time.RFC3339Nano)
+}
+
+func (dc *debugCapture) add(e consoleEntry) {
+	dc.mu.Lock()
+	dc.console = append(dc.console, e)
+	dc.mu.Unlock()
+}
+
+func (dc *debugCapture) onConsole(e *proto.RuntimeConsoleAPICalled) {
+	args := make([]string, 0, len(e.Args))
+	for _, arg := range e.Args {
+		switch {
+		case arg.Description != "":
+			args = append(args, arg.Description)
+		case arg.Value.Nil():
+			args = append(args, string(arg.Type))
+		default:
+			args = append(args, arg.Value.String())
+		}
+	}
+	dc.add(consoleEntry{
+		Time:   consoleTime(e.Timestamp),
+		Source: "console",
+		Level:  string(e.Type),
+		Text:   strings.Join(args, " "),
+	})
+}
+
+func (dc *debugCapture) onException(e *proto.RuntimeExceptionThrown) {
+	text := e.ExceptionDetails.Text
+	if e.ExceptionDetails.Exception != nil && e.ExceptionDetails.Exception.Description != "" {
+		text = e.ExceptionDetails.Exception.Description
+	}
+	dc.add(consoleEntry{
+		Time:   consoleTime(e.Timestamp),
+		Source: "exception",
+		Level:  "error",
+		Text:   text,
+		URL:    e.ExceptionDetails.URL,
+	})
+}
+
+func (dc *debugCapture) onLog(e *proto.LogEntryAdded) {
+	dc.add(consoleEntry{
+		Time:   consoleTime(e.Entry.Timestamp),
+		Source: string(e.Entry.Source),
+		Level:  string(e.Entry.Level),
+		Text:   e.Entry.Text,
+		URL:    e.Entry.URL,
+	})
+}
+
+// discard stops recording without saving anything
+func (dc *debugCapture) discard() {
+	if dc != nil {
+		dc.stop()
+	}
+}
+
+// save stops recording and writes every artifact of the failed extraction.
+// It must run while the page is still open and is best effort: whatever can
+// be captured is saved.
+func (dc *debugCapture) save(ctx context.Context, page *rod.Page, timeout time.Duration, info DebugCaptureInfo) {
+	if dc == nil {
+		return
+	}
+	dc.stop()
+	logger := loggerFrom(ctx)
+
+	// Retries of one request each get a capture of their own
+	info.ID = requestIDFrom(ctx)
+	if info.ID != "" && info.Attempt > 1 {
+		info.ID = fmt.Sprintf("%s-%d", info.ID, info.Attempt)
+	}
+	if !validCaptureID(info.ID) {
+		info.ID = newRequestID()
+	}
+	info.Time = time.Now().UTC().Format(time.RFC3339Nano)
+
+	captureCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	p := page.Context(captureCtx)
+
+	files := make(map[string][]byte)
+	if img, err := p.Screenshot(true, &proto.PageCaptureScreenshot{Format: proto.PageCaptureScreenshotFormatPng}); err == nil {
+		files[debugScreenshotFile] = img
+	} else {
+		logger.Debug("debug screenshot failed", "error", err)
+	}
+	if html, err := p.HTML(); err == nil {
+		files[debugHTMLFile] = []byte(html)
+	} else {
+		logger.Debug("debug HTML capture failed", "error", err)
+	}
+	dc.mu.Lock()
+	console := append([]consoleEntry{}, dc.console...)
+	dc.mu.Unlock()
+	if data, err := json.MarshalIndent(console, "", "  "); err == nil {
+		files[debugConsoleFile] = data
+	}
+	if data, err := json.MarshalIndent(dc.network.HAR(), "", "  "); err == nil {
+		files[debugNetworkFile] = data
+	}
+
+	dir, err := dc.store.write(info, files)
+	if err != nil {
+		logger.Warn("failed to save debug artifacts", "error", err)
+		return
+	}
+	logger.Info("saved debug artifacts", "debug_id", info.ID, "dir", dir)
+}
+
+// write stores one capture and prunes the oldest ones past the limit
+func (s *debugStore) write(info DebugCaptureInfo, files map[string][]byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.dir, info.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return "", err
+		}
+		info.Files = append(info.Files, name)
+	}
+	sort.Strings(info.Files)
+	if err := writeJSONFile(filepath.Join(dir, debugInfoFile), info); err != nil {
+		return "", err
+	}
+
+	s.prune()
+	return dir, nil
+}
+
+// prune deletes the oldest captures past the limit; s.mu must be held
+func (s *debugStore) prune() {
+	captures, err := s.list()
+	if err != nil || len(captures) <= s.max {
+		return
+	}
+	for _, c := range captures[s.max:] {
+		if err := os.RemoveAll(filepath.Join(s.dir, c.ID)); err != nil {
+			slog.Warn("failed to delete old debug capture", "debug_id", c.ID, "error", err)
+		}
+	}
+}
+
+// list returns every capture, newest first
+func (s *debugStore) list() ([]DebugCaptureInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var captures []DebugCaptureInfo
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		info, err := s.info(e.Name())
+		if err != nil {
+			continue
+		}
+		captures = append(captures, info)
+	}
+	sort.Slice(captures, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339Nano, captures[i].Time)
+		tj, _ := time.Parse(time.RFC3339Nano, captures[j].Time)
+		return ti.After(tj)
+	})
+	return captures, nil
+}
+
+// info reads the info.json of capture id
+func (s *debugStore) info(id string) (DebugCaptureInfo, error) {
+	var info DebugCaptureInfo
+	data, err := os.ReadFile(filepath.Join(s.dir, id, debugInfoFile))
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("invalid %s: %v", debugInfoFile, err)
+	}
+	info.ID = id
+	return info, nil
+}
+
+// handleAdminDebug lists debug captures and serves their files:
+//
+//	GET /api/admin/debug             every capture, newest first
+//	GET /api/admin/debug/{id}        one capture's info
+//	GET /api/admin/debug/{id}/{file} one artifact, e.g. screenshot.png
+func handleAdminDebug(store *debugStore) http.HandlerFunc {
+	writeError := func(w http.ResponseWriter, status int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Error:   msg,
+			Success: false,
+		})
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if store == nil {
+			writeError(w, http.StatusNotFound, "Debug capture is not enabled on this server")
+			return
+		}
+
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/debug"), "/")
+		if rest == "" {
+			store.mu.Lock()
+			captures, err := store.list()
+			store.mu.Unlock()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to list debug captures: %v", err))
+				return
+			}
+			if captures == nil {
+				captures = []DebugCaptureInfo{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"captures": captures,
+			})
+			return
+		}
+
+		id, file, _ := strings.Cut(rest, "/")
+		if !validCaptureID(id) {
+			writeError(w, http.StatusNotFound, "Debug capture not found")
+			return
+		}
+		info, err := store.info(id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "Debug capture not found")
+			return
+		}
+
+		if file == "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(info)
+			return
+		}
+		// Only the files the capture lists can be fetched
+		for _, name := range info.Files {
+			if name == file {
+				if file == debugNetworkFile {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				// Captured pages are Threads' markup; never let them run on this origin
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+"-"+name))
+				w.Header().Set("X-Content-Type-Options", "nosniff")
+				w.Header().Set("Content-Security-Policy", "sandbox")
+				w.Header().Set("Cache-Control", "no-store")
+				http.ServeFile(w, r, filepath.Join(store.dir, id, name))
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "Debug artifact not found")
+	}
+}
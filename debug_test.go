@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCapture stores a capture with the given ID and age
+func writeTestCapture(t *testing.T, store *debugStore, id string, at time.Time) {
+	t.Helper()
+	info := DebugCaptureInfo{ID: id, Time: at.UTC().Format(time.RFC3339Nano), URL: "https://www.threads.net/@user/post/" + id, Error: "unable to find media URLs"}
+	files := map[string][]byte{
+		debugHTMLFile:    []byte("<html>" + id + "</html>"),
+		debugConsoleFile: []byte("[]"),
+	}
+	if _, err := store.write(info, files); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDebugStorePrunesOldest(t *testing.T) {
+	store := newDebugStore(DebugConfig{Enabled: true, Dir: t.TempDir(), MaxCaptures: 2})
+	now := time.Now()
+	writeTestCapture(t, store, "old", now.Add(-2*time.Minute))
+	writeTestCapture(t, store, "mid", now.Add(-time.Minute))
+	writeTestCapture(t, store, "new", now)
+
+	captures, err := store.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != 2 || captures[0].ID != "new" || captures[1].ID != "mid" {
+		t.Fatalf("captures = %+v, want new and mid", captures)
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, "old")); !os.IsNotExist(err) {
+		t.Error("oldest capture was not deleted")
+	}
+}
+
+func TestHandleAdminDebug(t *testing.T) {
+	store := newDebugStore(DebugConfig{Enabled: true, Dir: t.TempDir(), MaxCaptures: 10})
+	writeTestCapture(t, store, "req-1", time.Now())
+	os.WriteFile(filepath.Join(store.dir, "secret.txt"), []byte("secret"), 0o644)
+	handler := handleAdminDebug(store)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/api/admin/debug")
+	var list struct {
+		Captures []DebugCaptureInfo `json:"captures"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil || len(list.Captures) != 1 {
+		t.Fatalf("list = %d %s", w.Code, w.Body)
+	}
+	if got := strings.Join(list.Captures[0].Files, ","); got != "console.json,page.html" {
+		t.Errorf("files = %s", got)
+	}
+
+	if w := get("/api/admin/debug/req-1"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"error":"unable to find media URLs"`) {
+		t.Errorf("info = %d %s", w.Code, w.Body)
+	}
+	w = get("/api/admin/debug/req-1/page.html")
+	if w.Code != http.StatusOK || w.Body.String() != "<html>req-1</html>" {
+		t.Errorf("file = %d %s", w.Code, w.Body)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") ||
+		w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("Content-Security-Policy") != "sandbox" {
+		t.Errorf("captured page served inline: %v", w.Header())
+	}
+
+	for _, path := range []string{
+		"/api/admin/debug/missing",
+		"/api/admin/debug/req-1/screenshot.png", // not captured
+		"/api/admin/debug/req-1/info.json",
+		"/api/admin/debug/req-1/../secret.txt",
+		"/api/admin/debug/../secret.txt",
+		"/api/admin/debug/..",
+	} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handleAdminDebug(nil)(w, httptest.NewRequest("GET", "/api/admin/debug", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("disabled debug artifacts = %d, want 404", w.Code)
+	}
+}
+
+func TestDebugCaptureOnFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><p>No video here</p><script>console.log("page script ran")</script></body></html>`))
+	}))
+	defer srv.Close()
+
+	te := newTestExtractor(t, srv)
+	te.cfg.Extraction.HTTPFirst = false
+	te.cfg.Extraction.EmbedFallback = false
+	te.debug = newDebugStore(DebugConfig{Enabled: true, Dir: t.TempDir(), MaxCaptures: 10})
+
+	ctx := context.WithValue(context.Background(), requestIDContextKey{}, "debug-test")
+	if _, err := te.extractMediaURL(ctx, "https://www.threads.net/@user/post/ABC123"); err == nil {
+		t.Fatal("expected the extraction to fail")
+	}
+
+	info, err := te.debug.info("debug-test")
+	if err != nil {
+		t.Fatalf("no capture saved: %v", err)
+	}
+	want := []string{debugConsoleFile, debugNetworkFile, debugHTMLFile, debugScreenshotFile}
+	if got := strings.Join(info.Files, ","); got != strings.Join(want, ",") {
+		t.Errorf("files = %s, want %v", got, want)
+	}
+	console, _ := os.ReadFile(filepath.Join(te.debug.dir, "debug-test", debugConsoleFile))
+	if !strings.Contains(string(console), "page script ran") {
+		t.Errorf("console log missing the page's message: %s", console)
+	}
+	har, _ := os.ReadFile(filepath.Join(te.debug.dir, "debug-test", debugNetworkFile))
+	if !strings.Contains(string(har), "/@user/post/ABC123") {
+		t.Error("network log missing the post request")
+	}
+}
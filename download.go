@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errInvalidMediaURL is returned for media URLs that can't be requested at all
+var errInvalidMediaURL = errors.New("invalid media URL")
+
+// mediaStatusError reports a non-200 answer from the media CDN
+type mediaStatusError struct {
+	status int
+}
+
+func (e *mediaStatusError) Error() string {
+	return fmt.Sprintf("media fetch failed with status %d", e.status)
+}
+
+// mediaFetcher fetches media files from the CDN. It is shared by the
+// /api/download proxy and the CLI so both behave the same way.
+type mediaFetcher struct {
+	client  *http.Client
+	proxies *proxyPool
+}
+
+// newMediaFetcher creates a fetcher using the download settings. Fetches go
+// through proxies when it isn't nil.
+func newMediaFetcher(cfg DownloadConfig, proxies *proxyPool) *mediaFetcher {
+	return &mediaFetcher{
+		client: &http.Client{
+			Timeout:   cfg.Timeout.Std(),
+			Transport: proxiedTransport(),
+		},
+		proxies: proxies,
+	}
+}
+
+// open starts fetching mediaURL; the caller must close the response body.
+// Cancelling ctx aborts the transfer.
+func (f *mediaFetcher) open(ctx context.Context, mediaURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", mediaURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidMediaURL, err)
+	}
+	// CDN URLs carry a fresh signature each time, the path is what identifies the file
+	proxy := f.proxies.pick(req.URL.Host + req.URL.Path)
+	req = req.WithContext(withProxy(ctx, proxy))
+
+	resp, err := f.client.Do(req)
+	if ctx.Err() == nil {
+		f.proxies.report(proxy, proxyFailure(resp, err))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &mediaStatusError{status: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// save downloads mediaURL into dest through a temporary file, so an interrupted
+// download never leaves a partial file behind. progress, if not nil, is called
+// as bytes arrive with the expected total (-1 when unknown).
+func (f *mediaFetcher) save(ctx context.Context, mediaURL, dest string, progress func(written, total int64)) (int64, error) {
+	resp, err := f.open(ctx, mediaURL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.part")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	var dst io.Writer = tmp
+	if progress != nil {
+		dst = &progressWriter{w: tmp, total: resp.ContentLength, report: progress}
+	}
+
+	written, err := io.Copy(dst, resp.Body)
+	if err != nil {
+		tmp.Close()
+		return written, fmt.Errorf("download interrupted: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return written, fmt.Errorf("failed to write file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return written, fmt.Errorf("failed to move file into place: %v", err)
+	}
+	return written, nil
+}
+
+// progressWriter reports cumulative bytes written, throttled to a few updates per second
+type progressWriter struct {
+	w        io.Writer
+	total    int64
+	written  int64
+	report   func(written, total int64)
+	lastTick time.Time
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if now := time.Now(); now.Sub(p.lastTick) >= 200*time.Millisecond || p.written == p.total {
+		p.lastTick = now
+		p.report(p.written, p.total)
+	}
+	return n, err
+}
+
+// mediaFilename picks a file name for an extracted post: the post ID plus an
+// extension taken from the media URL, falling back to the media type
+func mediaFilename(postURL string, result *ExtractResponse) string {
+	name := "media"
+	if u, err := url.Parse(postURL); err == nil {
+		if base := path.Base(strings.TrimSuffix(u.Path, "/")); base != "." && base != "/" {
+			name = base
+		}
+	}
+
+	ext := ""
+	if u, err := url.Parse(result.MediaURL); err == nil {
+		ext = strings.ToLower(path.Ext(u.Path))
+	}
+	if ext == "" || len(ext) > 5 {
+		if result.MediaType == "image" {
+			ext = ".jpg"
+		} else {
+			ext = ".mp4"
+		}
+	}
+	return name + ext
+}
+
+// formatBytes renders a byte count for humans
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
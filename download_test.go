@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMediaFetcherSave(t *testing.T) {
+	body := []byte("not really an mp4")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/clip.mp4" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	fetcher := newMediaFetcher(DefaultConfig().Download, nil)
+	dir := t.TempDir()
+
+	dest := filepath.Join(dir, "clip.mp4")
+	var lastWritten int64
+	written, err := fetcher.save(context.Background(), srv.URL+"/clip.mp4", dest, func(w, total int64) {
+		lastWritten = w
+	})
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if written != int64(len(body)) || lastWritten != written {
+		t.Errorf("written = %d, progress saw %d, want %d", written, lastWritten, len(body))
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil || string(got) != string(body) {
+		t.Fatalf("saved file = %q, %v", got, err)
+	}
+
+	missing := filepath.Join(dir, "missing.mp4")
+	_, err = fetcher.save(context.Background(), srv.URL+"/missing.mp4", missing, nil)
+	var statusErr *mediaStatusError
+	if !errors.As(err, &statusErr) || statusErr.status != http.StatusNotFound {
+		t.Fatalf("expected a 404 status error, got %v", err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("failed download left a file behind")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the saved file in %s, found %d entries", dir, len(entries))
+	}
+
+	if _, err := fetcher.save(context.Background(), "://bad", filepath.Join(dir, "bad.mp4"), nil); !errors.Is(err, errInvalidMediaURL) {
+		t.Errorf("expected errInvalidMediaURL, got %v", err)
+	}
+}
+
+func TestMediaFilename(t *testing.T) {
+	tests := []struct {
+		post   string
+		result ExtractResponse
+		want   string
+	}{
+		{"https://www.threads.net/@user/post/ABC123", ExtractResponse{MediaURL: "https://cdn.example/v/clip.mp4?x=1", MediaType: "video"}, "ABC123.mp4"},
+		{"https://www.threads.net/@user/post/ABC123/", ExtractResponse{MediaURL: "https://cdn.example/v/photo.JPG", MediaType: "image"}, "ABC123.jpg"},
+		{"https://www.threads.net/@user/post/ABC123", ExtractResponse{MediaURL: "https://video.fbcdn.net/v/stream", MediaType: "video"}, "ABC123.mp4"},
+		{"https://www.threads.net/@user/post/ABC123", ExtractResponse{MediaURL: "https://cdn.example/v/photo", MediaType: "image"}, "ABC123.jpg"},
+	}
+
+	for _, tt := range tests {
+		if got := mediaFilename(tt.post, &tt.result); got != tt.want {
+			t.Errorf("mediaFilename(%q, %q) = %q, want %q", tt.post, tt.result.MediaURL, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// embedURL is the public embed variant of a post URL
+func embedURL(postURL string) string {
+	return strings.TrimSuffix(postURL, "/") + "/embed"
+}
+
+// extractFromEmbedPage navigates page to the post's /embed variant and runs the
+// DOM and source strategies there. Embeds are served without the login wall
+// and hold only the post, so they often work when the full page doesn't.
+func (te *ThreadsExtractor) extractFromEmbedPage(parent context.Context, page *rod.Page, targetURL string) *ExtractResponse {
+	logger := loggerFrom(parent)
+	navCtx, cancel := context.WithTimeout(parent, te.cfg.Extraction.NavigationTimeout.Std())
+	defer cancel()
+
+	target := embedURL(targetURL)
+	ready := te.watchReadiness(navCtx, page)
+	if err := page.Context(navCtx).Navigate(target); err != nil {
+		ready.cancel()
+		logger.Debug("embed page navigation failed", "target", target, "error", err)
+		return nil
+	}
+	logger.Debug("embed page ready", "signal", ready.wait(page))
+
+	if result := te.extractFromDOMElements(parent, page, "video"); result != nil {
+		return result
+	}
+	return te.extractFromSourceCode(parent, page, "video")
+}
+
+// Defaults for /api/oembed responses
+const (
+	oEmbedWidth       = 550
+	oEmbedHeight      = 720
+	oEmbedCacheAge    = 3600
+	oEmbedProvider    = "Threads"
+	oEmbedProviderURL = "https://www.threads.net"
+)
+
+// OEmbedResponse is an oEmbed 1.0 "rich" response, see https://oembed.com
+type OEmbedResponse struct {
+	Version         string `json:"version"`
+	Type            string `json:"type"`
+	ProviderName    string `json:"provider_name"`
+	ProviderURL     string `json:"provider_url"`
+	Title           string `json:"title,omitempty"`
+	AuthorName      string `json:"author_name,omitempty"`
+	AuthorURL       string `json:"author_url,omitempty"`
+	CacheAge        int    `json:"cache_age,omitempty"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+	HTML            string `json:"html"`
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+}
+
+var postAuthorPattern = regexp.MustCompile(`^/@([\w.-]+)/post/`)
+
+// buildOEmbed describes a post from its extraction result. The embed itself is
+// an iframe of the post's /embed page, sized to fit maxWidth x maxHeight (0
+// means no limit). A narrower width scales the height with it.
+func buildOEmbed(postURL string, result *ExtractResponse, maxWidth, maxHeight int) OEmbedResponse {
+	width, height := oEmbedWidth, oEmbedHeight
+	if maxWidth > 0 && width > maxWidth {
+		width = maxWidth
+		height = oEmbedHeight * width / oEmbedWidth
+	}
+	if maxHeight > 0 && height > maxHeight {
+		height = maxHeight
+	}
+
+	resp := OEmbedResponse{
+		Version:      "1.0",
+		Type:         "rich",
+		ProviderName: oEmbedProvider,
+		ProviderURL:  oEmbedProviderURL,
+		CacheAge:     oEmbedCacheAge,
+		Width:        width,
+		Height:       height,
+		HTML: fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" frameborder="0" scrolling="no" allowtransparency="true" style="border:0;max-width:100%%"></iframe>`,
+			html.EscapeString(embedURL(postURL)), width, height),
+	}
+
+	author := ""
+	if m := postAuthorPattern.FindStringSubmatch(strings.TrimPrefix(postURL, oEmbedProviderURL)); m != nil {
+		author = m[1]
+		resp.AuthorName = author
+		resp.AuthorURL = oEmbedProviderURL + "/@" + author
+	}
+
+	switch {
+	case result.Caption != "":
+		resp.Title = result.Caption
+	case result.Title != "":
+		resp.Title = result.Title
+	case author != "":
+		resp.Title = fmt.Sprintf("Post by @%s on Threads", author)
+	}
+
+	resp.ThumbnailURL = result.Thumbnail
+	if resp.ThumbnailURL == "" && result.MediaType == "image" {
+		resp.ThumbnailURL = result.MediaURL
+	}
+	return resp
+}
+
+// thumbnailSize reads just enough of an image to learn its dimensions
+func thumbnailSize(ctx context.Context, fetcher *mediaFetcher, thumbnailURL string) (int, int, error) {
+	resp, err := fetcher.open(ctx, thumbnailURL)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	cfg, _, err := image.DecodeConfig(resp.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// writeOEmbedError answers with the status codes the oEmbed spec defines
+func writeOEmbedError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	recordError(r)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   msg,
+		Success: false,
+	})
+}
+
+// handleOEmbed serves oEmbed JSON for a Threads post so CMSs can embed it:
+// GET /api/oembed?url=<post URL>[&maxwidth=N][&maxheight=N][&format=json]
+func handleOEmbed(te *ThreadsExtractor, cfg DownloadConfig) http.HandlerFunc {
+	fetcher := newMediaFetcher(cfg, te.proxies)
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := loggerFrom(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != "GET" {
+			writeOEmbedError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		q := r.URL.Query()
+		if format := q.Get("format"); format != "" && format != "json" {
+			writeOEmbedError(w, r, http.StatusNotImplemented, "Only the json format is supported")
+			return
+		}
+		postURL := q.Get("url")
+		if postURL == "" {
+			writeOEmbedError(w, r, http.StatusBadRequest, "url parameter is required")
+			return
+		}
+		var maxWidth, maxHeight int
+		for name, dst := range map[string]*int{"maxwidth": &maxWidth, "maxheight": &maxHeight} {
+			if v := q.Get(name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n <= 0 {
+					writeOEmbedError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid %s %q", name, v))
+					return
+				}
+				*dst = n
+			}
+		}
+
+		normalized, err := te.normalizeURL(postURL)
+		if err != nil {
+			// The spec's answer for URLs the provider doesn't serve
+			writeOEmbedError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+
+		result, err := te.extractMediaURL(r.Context(), normalized)
+		if err != nil {
+			if r.Context().Err() != nil {
+				return
+			}
+			logger.Warn("extraction for oEmbed failed", "url", normalized, "error", err)
+			writeOEmbedError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		recordExtraction(r)
+
+		resp := buildOEmbed(normalized, result, maxWidth, maxHeight)
+		if resp.ThumbnailURL != "" {
+			// The spec requires the thumbnail's size alongside its URL
+			if tw, th, err := thumbnailSize(r.Context(), fetcher, resp.ThumbnailURL); err == nil {
+				resp.ThumbnailWidth, resp.ThumbnailHeight = tw, th
+			} else {
+				logger.Debug("dropping thumbnail of unknown size", "url", resp.ThumbnailURL, "error", err)
+				resp.ThumbnailURL = ""
+			}
+		}
+
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", oEmbedCacheAge))
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestBuildOEmbed(t *testing.T) {
+	postURL := "https://www.threads.net/@some.user/post/ABC123"
+
+	got := buildOEmbed(postURL, &ExtractResponse{MediaType: "image", MediaURL: "https://cdn.example/p.jpg", Title: "Page title"}, 400, 0)
+	if got.Version != "1.0" || got.Type != "rich" || got.ProviderName != "Threads" {
+		t.Errorf("unexpected envelope %+v", got)
+	}
+	if got.AuthorName != "some.user" || got.AuthorURL != "https://www.threads.net/@some.user" {
+		t.Errorf("author = %q %q", got.AuthorName, got.AuthorURL)
+	}
+	if got.Title != "Page title" {
+		t.Errorf("title = %q", got.Title)
+	}
+	if got.ThumbnailURL != "https://cdn.example/p.jpg" {
+		t.Errorf("image posts should use the image as thumbnail, got %q", got.ThumbnailURL)
+	}
+	if got.Width != 400 || got.Height != oEmbedHeight*400/oEmbedWidth {
+		t.Errorf("size = %dx%d, want the default aspect ratio at width 400", got.Width, got.Height)
+	}
+	if !strings.Contains(got.HTML, `src="https://www.threads.net/@some.user/post/ABC123/embed"`) || !strings.Contains(got.HTML, `width="400" height="523"`) {
+		t.Errorf("html = %s", got.HTML)
+	}
+
+	got = buildOEmbed(postURL, &ExtractResponse{MediaType: "video", Caption: "A <b>caption</b>"}, 600, 300)
+	if got.Title != "A <b>caption</b>" || got.ThumbnailURL != "" {
+		t.Errorf("title = %q, thumbnail = %q", got.Title, got.ThumbnailURL)
+	}
+	if got.Width != oEmbedWidth || got.Height != 300 {
+		t.Errorf("size = %dx%d, want %dx300", got.Width, got.Height, oEmbedWidth)
+	}
+
+	// Consumers must never get more than they asked for, however narrow
+	for _, maxWidth := range []int{319, 200, 100, 1} {
+		got = buildOEmbed(postURL, &ExtractResponse{MediaType: "video"}, maxWidth, 0)
+		if got.Width != maxWidth || got.Height != oEmbedHeight*maxWidth/oEmbedWidth {
+			t.Errorf("maxwidth %d: size = %dx%d", maxWidth, got.Width, got.Height)
+		}
+	}
+	got = buildOEmbed(postURL, &ExtractResponse{MediaType: "video"}, 200, 100)
+	if got.Width != 200 || got.Height != 100 {
+		t.Errorf("maxwidth 200, maxheight 100: size = %dx%d, want 200x100", got.Width, got.Height)
+	}
+
+	got = buildOEmbed(postURL, &ExtractResponse{MediaType: "video"}, 0, 0)
+	if got.Title != "Post by @some.user on Threads" {
+		t.Errorf("fallback title = %q", got.Title)
+	}
+}
+
+func TestHandleOEmbed(t *testing.T) {
+	var thumb bytes.Buffer
+	png.Encode(&thumb, image.NewRGBA(image.Rect(0, 0, 64, 48)))
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/@fixtureuser/post/OEMBED1":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head>
+<meta property="og:description" content="Clip of the day">
+<meta property="og:image" content="` + srv.URL + `/thumb.png">
+</head><body><video src="` + srv.URL + `/clip.mp4"></video></body></html>`))
+		case "/thumb.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(thumb.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	te := &ThreadsExtractor{cfg: cfg, pageClient: newPageClient(), profiles: newProfileRotator(cfg.Browser)}
+	te.rewriteURL = func(u string) string {
+		return strings.Replace(u, "https://www.threads.net", srv.URL, 1)
+	}
+	handler := handleOEmbed(te, cfg.Download)
+
+	postURL := "https://www.threads.net/@fixtureuser/post/OEMBED1"
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/api/oembed?url="+url.QueryEscape(postURL), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var got OEmbedResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Clip of the day" || got.AuthorName != "fixtureuser" {
+		t.Errorf("title = %q, author = %q", got.Title, got.AuthorName)
+	}
+	if got.ThumbnailURL != srv.URL+"/thumb.png" || got.ThumbnailWidth != 64 || got.ThumbnailHeight != 48 {
+		t.Errorf("thumbnail = %q %dx%d", got.ThumbnailURL, got.ThumbnailWidth, got.ThumbnailHeight)
+	}
+	if rec.Header().Get("Cache-Control") == "" {
+		t.Errorf("missing Cache-Control")
+	}
+
+	errorCases := []struct {
+		query string
+		want  int
+	}{
+		{"format=xml&url=" + url.QueryEscape(postURL), http.StatusNotImplemented},
+		{"", http.StatusBadRequest},
+		{"maxwidth=wide&url=" + url.QueryEscape(postURL), http.StatusBadRequest},
+		{"url=" + url.QueryEscape("https://example.com/video"), http.StatusNotFound},
+	}
+	for _, tc := range errorCases {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", "/api/oembed?"+tc.query, nil))
+		if rec.Code != tc.want {
+			t.Errorf("%q: status = %d, want %d", tc.query, rec.Code, tc.want)
+		}
+	}
+}
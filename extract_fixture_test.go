@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod/lib/launcher"
+)
+
+// fixture is one saved post page with its expected extraction result
+type fixture struct {
+	name     string
+	dir      string
+	expected fixtureExpectation
+}
+
+// loadFixtures reads every fixture directory under testdata/fixtures
+func loadFixtures(t *testing.T) []fixture {
+	t.Helper()
+
+	dirs, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*", "expected.json"))
+	if err != nil {
+		t.Fatalf("failed to list fixtures: %v", err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("no fixtures found under testdata/fixtures")
+	}
+
+	var fixtures []fixture
+	for _, path := range dirs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+
+		var exp fixtureExpectation
+		if err := json.Unmarshal(data, &exp); err != nil {
+			t.Fatalf("failed to parse %s: %v", path, err)
+		}
+		if exp.URL == "" || (exp.Response == nil && exp.Error == "") {
+			t.Fatalf("%s must set url and either response or error", path)
+		}
+
+		dir := filepath.Dir(path)
+		fixtures = append(fixtures, fixture{name: filepath.Base(dir), dir: dir, expected: exp})
+	}
+	return fixtures
+}
+
+// replayedResponse is a same-origin response from a recorded network.har
+type replayedResponse struct {
+	status   int
+	mimeType string
+	body     []byte
+}
+
+// newFixtureServer serves each fixture's page.html at its post path. Fixtures
+// captured with `threadsvid record` also get their recorded threads.net
+// responses replayed, so the page's own XHRs see the data they saw live.
+func newFixtureServer(t *testing.T, fixtures []fixture) *httptest.Server {
+	t.Helper()
+
+	pages := make(map[string]string)
+	replay := make(map[string]replayedResponse)
+	for _, f := range fixtures {
+		u, err := url.Parse(f.expected.URL)
+		if err != nil {
+			t.Fatalf("fixture %s has invalid url: %v", f.name, err)
+		}
+		pages[strings.TrimSuffix(u.Path, "/")] = filepath.Join(f.dir, "page.html")
+
+		har, err := loadHAR(filepath.Join(f.dir, "network.har"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("fixture %s: %v", f.name, err)
+		}
+		for _, e := range har.Log.Entries {
+			eu, err := url.Parse(e.Request.URL)
+			if err != nil || eu.Host != u.Host || e.Response.Status == 0 {
+				continue
+			}
+			body, err := e.Response.Content.Body()
+			if err != nil {
+				t.Fatalf("fixture %s: bad body for %s: %v", f.name, e.Request.URL, err)
+			}
+			replay[eu.RequestURI()] = replayedResponse{e.Response.Status, e.Response.Content.MimeType, body}
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path, ok := pages[strings.TrimSuffix(r.URL.Path, "/")]; ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			http.ServeFile(w, r, path)
+			return
+		}
+		if resp, ok := replay[r.URL.RequestURI()]; ok {
+			w.Header().Set("Content-Type", resp.mimeType)
+			w.WriteHeader(resp.status)
+			w.Write(resp.body)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestExtractor launches a real browser pointed at the fixture server, or skips
+// the test when no Chrome/Chromium is installed
+func newTestExtractor(t *testing.T, srv *httptest.Server) *ThreadsExtractor {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping browser fixture tests in -short mode")
+	}
+
+	cfg := DefaultConfig()
+	cfg.Browser.ChromePath = os.Getenv("CHROME_PATH")
+	if cfg.Browser.ChromePath == "" {
+		path, found := launcher.LookPath()
+		if !found {
+			t.Skip("no Chrome/Chromium found, set CHROME_PATH to run browser fixture tests")
+		}
+		cfg.Browser.ChromePath = path
+	}
+
+	// Fixtures are local, keep the waits short so missing elements fail fast
+	cfg.Extraction.NavigationTimeout = Duration(3 * time.Second)
+	cfg.Extraction.NetworkIdle = Duration(100 * time.Millisecond)
+
+	te, err := NewThreadsExtractor(cfg)
+	if err != nil {
+		t.Fatalf("failed to start browser: %v", err)
+	}
+	t.Cleanup(te.Close)
+
+	te.rewriteURL = func(u string) string {
+		return strings.Replace(u, "https://www.threads.net", srv.URL, 1)
+	}
+	return te
+}
+
+func TestExtractFixtures(t *testing.T) {
+	fixtures := loadFixtures(t)
+	srv := newFixtureServer(t, fixtures)
+	te := newTestExtractor(t, srv)
+
+	// Every fixture goes through the browser alone, then through the whole
+	// pipeline where the HTTP tier answers first whenever it can
+	modes := []struct {
+		name      string
+		httpFirst bool
+	}{
+		{"browser", false},
+		{"http_first", true},
+	}
+	for _, mode := range modes {
+		te.cfg.Extraction.HTTPFirst = mode.httpFirst
+		t.Run(mode.name, func(t *testing.T) {
+			for _, f := range fixtures {
+				f := f
+				t.Run(f.name, func(t *testing.T) {
+					ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+					defer cancel()
+
+					got, err := te.extractMediaURL(ctx, f.expected.URL)
+
+					if f.expected.Error != "" {
+						if err == nil {
+							t.Fatalf("expected error containing %q, got response %+v", f.expected.Error, got)
+						}
+						if !strings.Contains(err.Error(), f.expected.Error) {
+							t.Fatalf("error = %q, want it to contain %q", err, f.expected.Error)
+						}
+						return
+					}
+
+					if err != nil {
+						t.Fatalf("extractMediaURL failed: %v", err)
+					}
+					assertResponse(t, got, f.expected.Response)
+				})
+			}
+		})
+	}
+}
+
+// assertResponse compares the fields the fixture sets; empty expected fields are ignored
+func assertResponse(t *testing.T, got, want *ExtractResponse) {
+	t.Helper()
+
+	if got.Success != want.Success {
+		t.Errorf("success = %v, want %v", got.Success, want.Success)
+	}
+	if got.MediaType != want.MediaType {
+		t.Errorf("mediaType = %q, want %q", got.MediaType, want.MediaType)
+	}
+	if got.MediaURL != want.MediaURL {
+		t.Errorf("mediaUrl = %q, want %q", got.MediaURL, want.MediaURL)
+	}
+	if want.VideoID != "" && got.VideoID != want.VideoID {
+		t.Errorf("videoId = %q, want %q", got.VideoID, want.VideoID)
+	}
+	if want.Title != "" && got.Title != want.Title {
+		t.Errorf("title = %q, want %q", got.Title, want.Title)
+	}
+	if want.Duration != 0 && got.Duration != want.Duration {
+		t.Errorf("duration = %d, want %d", got.Duration, want.Duration)
+	}
+	for k, v := range want.VideoUrls {
+		if got.VideoUrls[k] != v {
+			t.Errorf("videoUrls[%q] = %q, want %q", k, got.VideoUrls[k], v)
+		}
+	}
+}
+
+func TestFixtureServerServesPages(t *testing.T) {
+	fixtures := loadFixtures(t)
+	srv := newFixtureServer(t, fixtures)
+
+	for _, f := range fixtures {
+		u, _ := url.Parse(f.expected.URL)
+		resp, err := http.Get(srv.URL + u.Path)
+		if err != nil {
+			t.Fatalf("%s: %v", f.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status %d", f.name, resp.StatusCode)
+		}
+	}
+}
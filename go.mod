@@ -2,7 +2,10 @@ module threadsvid-backend
 
 go 1.21
 
-require github.com/go-rod/rod v0.114.8
+require (
+	github.com/go-rod/rod v0.114.8
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/ysmood/fetchup v0.2.3 // indirect
@@ -11,4 +14,3 @@ require (
 	github.com/ysmood/gson v0.7.3 // indirect
 	github.com/ysmood/leakless v0.8.0 // indirect
 )
-
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ComponentStatus is the readiness result of a single dependency
+type ComponentStatus struct {
+	Name      string                 `json:"name"`
+	Status    string                 `json:"status"` // "ok" or "fail"
+	LatencyMs float64                `json:"latencyMs"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// ReadinessReport is the /readyz response body
+type ReadinessReport struct {
+	Status     string            `json:"status"` // "ready" or "not_ready"
+	Components []ComponentStatus `json:"components"`
+	Time       string            `json:"time"`
+}
+
+// readinessCheck probes one component; details are reported even on failure
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) (map[string]interface{}, error)
+}
+
+// browserCheck fails while the browser is relaunching or doesn't answer over
+// CDP. It asks for the version rather than opening a tab, since /readyz is
+// unauthenticated and polled often.
+func browserCheck(te *ThreadsExtractor) readinessCheck {
+	return readinessCheck{
+		name: "browser",
+		check: func(ctx context.Context) (map[string]interface{}, error) {
+			if te.Relaunching() {
+				return nil, fmt.Errorf("browser is relaunching")
+			}
+
+			version, err := te.currentBrowser().Context(ctx).Version()
+			if err != nil {
+				return nil, fmt.Errorf("browser did not respond: %v", err)
+			}
+			return map[string]interface{}{"product": version.Product}, nil
+		},
+	}
+}
+
+// pageCapacityCheck fails when every extraction page slot is taken
+func pageCapacityCheck(te *ThreadsExtractor) readinessCheck {
+	return readinessCheck{
+		name: "page_pool",
+		check: func(ctx context.Context) (map[string]interface{}, error) {
+			inUse, capacity := te.PageCapacity()
+			details := map[string]interface{}{
+				"inUse":    inUse,
+				"capacity": capacity,
+			}
+			if inUse >= capacity {
+				return details, fmt.Errorf("all %d browser pages are busy", capacity)
+			}
+			return details, nil
+		},
+	}
+}
+
+// proxyPoolCheck fails when every upstream proxy is ejected
+func proxyPoolCheck(pool *proxyPool) readinessCheck {
+	return readinessCheck{
+		name: "proxy_pool",
+		check: func(ctx context.Context) (map[string]interface{}, error) {
+			healthy, total := pool.healthy()
+			details := map[string]interface{}{
+				"healthy": healthy,
+				"total":   total,
+			}
+			if healthy == 0 {
+				return details, fmt.Errorf("all %d upstream proxies are ejected", total)
+			}
+			return details, nil
+		},
+	}
+}
+
+// storageCheck fails when the archive backend can't be reached
+func storageCheck(storage Storage, backend string) readinessCheck {
+	return readinessCheck{
+		name: "storage",
+		check: func(ctx context.Context) (map[string]interface{}, error) {
+			details := map[string]interface{}{"backend": backend}
+			if err := storage.Ping(ctx); err != nil {
+				return details, fmt.Errorf("storage backend unavailable: %v", err)
+			}
+			return details, nil
+		},
+	}
+}
+
+// runReadinessChecks runs every check concurrently within timeout
+func runReadinessChecks(ctx context.Context, checks []readinessCheck, timeout time.Duration) ReadinessReport {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make([]ComponentStatus, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			details, err := c.check(ctx)
+			status := ComponentStatus{
+				Name:      c.name,
+				Status:    "ok",
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Details:   details,
+			}
+			if err != nil {
+				status.Status = "fail"
+				status.Error = err.Error()
+			}
+			results[i] = status
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := ReadinessReport{
+		Status:     "ready",
+		Components: results,
+		Time:       time.Now().Format(time.RFC3339),
+	}
+	for _, r := range results {
+		if r.Status != "ok" {
+			report.Status = "not_ready"
+			break
+		}
+	}
+	return report
+}
+
+// handleHealthz is the liveness probe: the process is up and serving HTTP
+func handleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "healthy",
+			"time":   time.Now().Format(time.RFC3339),
+		})
+	}
+}
+
+// handleReadyz is the readiness probe: every component must be able to take work
+func handleReadyz(checks []readinessCheck, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := runReadinessChecks(r.Context(), checks, timeout)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != "ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readyz calls the readiness handler and decodes its report
+func readyz(t *testing.T, checks []readinessCheck) (int, ReadinessReport) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handleReadyz(checks, time.Second)(w, httptest.NewRequest("GET", "/readyz", nil))
+	var report ReadinessReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, report
+}
+
+// component finds a component of the report by name
+func component(report ReadinessReport, name string) ComponentStatus {
+	for _, c := range report.Components {
+		if c.Name == name {
+			return c
+		}
+	}
+	return ComponentStatus{}
+}
+
+func TestReadyzLocalStorage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "archive")
+	storage, err := NewStorage(StorageConfig{Backend: "local", Local: LocalStorageConfig{Dir: dir, BaseURL: "/media/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []readinessCheck{storageCheck(storage, "local")}
+
+	code, report := readyz(t, checks)
+	if code != http.StatusOK || report.Status != "ready" {
+		t.Fatalf("readyz = %d %+v, want ready", code, report)
+	}
+	if c := component(report, "storage"); c.Status != "ok" || c.Details["backend"] != "local" {
+		t.Errorf("storage component = %+v", c)
+	}
+
+	// The volume goes away
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	code, report = readyz(t, checks)
+	if code != http.StatusServiceUnavailable || report.Status != "not_ready" {
+		t.Fatalf("readyz = %d %+v, want not ready", code, report)
+	}
+	if c := component(report, "storage"); c.Status != "fail" || c.Error == "" {
+		t.Errorf("storage component = %+v, want a failure", c)
+	}
+
+	// A file where the directory should be is no better
+	os.WriteFile(dir, nil, 0o644)
+	if code, _ := readyz(t, checks); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz = %d with a file in place of the directory, want 503", code)
+	}
+
+	// And it is back
+	os.Remove(dir)
+	os.Mkdir(dir, 0o755)
+	if code, report := readyz(t, checks); code != http.StatusOK || report.Status != "ready" {
+		t.Errorf("readyz = %d %+v after the directory came back, want ready", code, report)
+	}
+}
+
+func TestReadyzS3Storage(t *testing.T) {
+	s3 := &fakeS3{objects: make(map[string][]byte)}
+	s3srv := httptest.NewServer(s3)
+	defer s3srv.Close()
+
+	cfg := S3StorageConfig{
+		Endpoint:        s3srv.URL,
+		Region:          "us-east-1",
+		Bucket:          "archive",
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio123",
+		PathStyle:       true,
+		Prefix:          "media",
+	}
+	checks := []readinessCheck{storageCheck(newS3Storage(cfg), "s3")}
+	if code, report := readyz(t, checks); code != http.StatusOK {
+		t.Errorf("readyz = %d %+v, want ready", code, report)
+	}
+
+	// Credentials the server rejects
+	cfg.AccessKeyID = "wrong"
+	checks = []readinessCheck{storageCheck(newS3Storage(cfg), "s3")}
+	if code, report := readyz(t, checks); code != http.StatusServiceUnavailable || component(report, "storage").Error == "" {
+		t.Errorf("readyz = %d %+v, want not ready", code, report)
+	}
+
+	// The endpoint goes down
+	cfg.AccessKeyID = "minio"
+	checks = []readinessCheck{storageCheck(newS3Storage(cfg), "s3")}
+	s3srv.Close()
+	if code, _ := readyz(t, checks); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz = %d with the endpoint down, want 503", code)
+	}
+}
+
+func TestReadyzProxyPool(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Proxies.URLs = []string{"http://proxy-a:8080"}
+	cfg.Proxies.MaxFailures = 1
+	cfg.Proxies.HealthCheckURL = "" // ejections then expire on their own
+	pool := newProxyPool(cfg)
+	defer pool.Close()
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+	checks := []readinessCheck{proxyPoolCheck(pool)}
+
+	if code, _ := readyz(t, checks); code != http.StatusOK {
+		t.Fatalf("readyz = %d, want ready", code)
+	}
+
+	pool.report(pool.proxies[0], os.ErrDeadlineExceeded)
+	code, report := readyz(t, checks)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz = %d with every proxy ejected, want 503", code)
+	}
+	if c := component(report, "proxy_pool"); c.Details["healthy"] != float64(0) || c.Details["total"] != float64(1) {
+		t.Errorf("proxy_pool details = %v", c.Details)
+	}
+
+	// The ejection runs out
+	now = now.Add(cfg.Proxies.EjectFor.Std())
+	if code, _ := readyz(t, checks); code != http.StatusOK {
+		t.Errorf("readyz = %d after the ejection, want ready", code)
+	}
+}
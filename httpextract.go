@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// errNoHTTPMedia means the server-rendered pages didn't contain the media; the
+// browser may still find it once the page's JavaScript has run
+var errNoHTTPMedia = errors.New("no media URL in the server-rendered page")
+
+// maxPageBytes caps how much of a post page the HTTP tier reads
+const maxPageBytes = 8 << 20
+
+var (
+	tagPattern  = regexp.MustCompile(`(?is)<(meta|video|source|img)\b[^>]*>`)
+	attrPattern = regexp.MustCompile(`(?s)([\w:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// newPageClient creates the client used to fetch post pages, going through
+// the proxy picked for each extraction
+func newPageClient() *http.Client {
+	return &http.Client{Transport: proxiedTransport()}
+}
+
+// extractWithHTTP is the browserless first tier. It fetches the post page and
+// then its /embed page with a plain HTTP client and looks for the media in the
+// meta tags, media tags and embedded JSON. It returns the strategy that
+// succeeded ("http" or "http_embed"). Both fetches go through proxy, which
+// may be nil for a direct connection.
+func (te *ThreadsExtractor) extractWithHTTP(parent context.Context, normalizedURL string, profile BrowserProfile, proxy *upstreamProxy) (*ExtractResponse, string, error) {
+	logger := loggerFrom(parent)
+	ctx, cancel := context.WithTimeout(withProxy(parent, proxy), te.cfg.Extraction.HTTPTimeout.Std())
+	defer cancel()
+
+	pages := []struct {
+		strategy string
+		url      string
+	}{
+		{"http", normalizedURL},
+		{"http_embed", embedURL(normalizedURL)},
+	}
+
+	err := errNoHTTPMedia
+	for _, p := range pages {
+		target := p.url
+		if te.rewriteURL != nil {
+			target = te.rewriteURL(target)
+		}
+		target = profile.postURL(target)
+
+		_, stage := startSpan(ctx, "http.fetch")
+		stage.SetAttr("http.url", target)
+		body, fetchErr := te.fetchPage(ctx, target, profile)
+		stage.Finish(fetchErr)
+		if fetchErr != nil {
+			logger.Debug("HTTP page fetch failed", "url", target, "error", fetchErr)
+			err = fetchErr
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		if result := te.mediaFromHTML(ctx, body); result != nil {
+			return result, p.strategy, nil
+		}
+		err = errNoHTTPMedia
+	}
+	return nil, "", err
+}
+
+// fetchPage GETs a page the way profile's browser navigation would and returns its HTML
+func (te *ThreadsExtractor) fetchPage(ctx context.Context, pageURL string, profile BrowserProfile) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", profile.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	acceptLanguage := profile.AcceptLanguage
+	if acceptLanguage == "" {
+		acceptLanguage = "en-US,en;q=0.9"
+	}
+	req.Header.Set("Accept-Language", acceptLanguage)
+
+	resp, err := te.pageClient.Do(req)
+	if ctx.Err() == nil {
+		te.proxies.report(proxyFrom(ctx), proxyFailure(resp, err))
+	}
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("page returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// mediaFromHTML runs the extraction strategies that work on raw HTML. Images
+// are only considered when nothing on the page points at a video, so a video
+// post whose player needs JavaScript falls through to the browser instead of
+// returning its thumbnail.
+func (te *ThreadsExtractor) mediaFromHTML(ctx context.Context, page string) *ExtractResponse {
+	tags := parseHTMLTags(page)
+	lookup := func(tag metaTag) string { return tags.meta[tag] }
+
+	result := te.mediaFromMetaTags(ctx, "video", lookup)
+	if result == nil {
+		for _, src := range tags.videos {
+			if te.isValidVideoURL(src) {
+				result = &ExtractResponse{MediaURL: src, MediaType: "video", Success: true}
+				break
+			}
+		}
+	}
+	if result == nil {
+		result = te.mediaFromSource(ctx, page, "video")
+	}
+	if result == nil && !tags.hasVideo(page) {
+		result = te.mediaFromMetaTags(ctx, "image", lookup)
+		if result == nil {
+			result = te.mediaFromSource(ctx, page, "image")
+		}
+	}
+	if result == nil {
+		return nil
+	}
+
+	// Same rules as collectPostDetails, applied to the markup instead of the live DOM
+	result.Caption = strings.TrimSpace(tags.meta[metaTag{"property", "og:description"}])
+	result.Thumbnail = tags.meta[metaTag{"property", "og:image"}]
+	result.Items = []MediaItem{{URL: result.MediaURL, MediaType: result.MediaType}}
+	seen := map[string]bool{result.MediaURL: true}
+	for _, u := range tags.videos {
+		if !seen[u] && te.isValidVideoURL(u) {
+			seen[u] = true
+			result.Items = append(result.Items, MediaItem{URL: u, MediaType: "video"})
+		}
+	}
+	for _, u := range tags.images {
+		if !seen[u] && te.isValidImageURL(u) && !te.isValidVideoURL(u) && te.scoreImageURL(u) >= 100 {
+			seen[u] = true
+			result.Items = append(result.Items, MediaItem{URL: u, MediaType: "image"})
+		}
+	}
+	return result
+}
+
+// htmlTags holds the tags of a raw page the HTTP tier cares about
+type htmlTags struct {
+	meta   map[metaTag]string // content by property/name, first occurrence wins
+	videos []string           // src of <video> and <source> tags
+	images []string           // src of <img> tags
+}
+
+// parseHTMLTags scans page for meta and media tags. Attribute values are
+// HTML-unescaped, so URLs come out the way the DOM would report them.
+func parseHTMLTags(page string) htmlTags {
+	tags := htmlTags{meta: make(map[metaTag]string)}
+	for _, m := range tagPattern.FindAllStringSubmatch(page, -1) {
+		attrs := make(map[string]string)
+		for _, a := range attrPattern.FindAllStringSubmatch(m[0], -1) {
+			attrs[strings.ToLower(a[1])] = html.UnescapeString(a[2] + a[3])
+		}
+
+		switch strings.ToLower(m[1]) {
+		case "meta":
+			for _, attr := range []string{"property", "name"} {
+				key := metaTag{attr, strings.ToLower(attrs[attr])}
+				if _, ok := tags.meta[key]; key.value != "" && !ok {
+					tags.meta[key] = attrs["content"]
+				}
+			}
+		case "video", "source":
+			if src := attrs["src"]; src != "" {
+				tags.videos = append(tags.videos, src)
+			}
+		case "img":
+			if src := attrs["src"]; src != "" {
+				tags.images = append(tags.images, src)
+			}
+		}
+	}
+	return tags
+}
+
+// hasVideo reports whether the page looks like a video post even if no
+// playable URL could be read from it
+func (t htmlTags) hasVideo(page string) bool {
+	for _, tag := range videoMetaTags {
+		if t.meta[tag] != "" {
+			return true
+		}
+	}
+	return len(t.videos) > 0 || strings.Contains(page, "<video") ||
+		strings.Contains(page, `"video_versions":[{`) || strings.Contains(page, `"media_type":2`)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The HTTP tier needs no browser, so every fixture runs through it here. Posts
+// it can't handle must fail cleanly so extractMediaURL falls back to rod.
+func TestExtractWithHTTPFixtures(t *testing.T) {
+	fixtures := loadFixtures(t)
+	srv := newFixtureServer(t, fixtures)
+
+	cfg := DefaultConfig()
+	te := &ThreadsExtractor{cfg: cfg, pageClient: newPageClient(), profiles: newProfileRotator(cfg.Browser)}
+	te.rewriteURL = func(u string) string {
+		return strings.Replace(u, "https://www.threads.net", srv.URL, 1)
+	}
+
+	for _, f := range fixtures {
+		f := f
+		t.Run(f.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			normalized, err := te.normalizeURL(f.expected.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, strategy, err := te.extractWithHTTP(ctx, normalized, defaultProfiles[0], nil)
+
+			if f.expected.Error != "" {
+				if err == nil {
+					t.Fatalf("expected no result, got %+v via %s", got, strategy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractWithHTTP failed: %v", err)
+			}
+			if strategy != "http" {
+				t.Errorf("strategy = %q, want http", strategy)
+			}
+			assertResponse(t, got, f.expected.Response)
+		})
+	}
+}
+
+func TestMediaFromHTMLCollectsItems(t *testing.T) {
+	page := `<html><head>
+<meta property="og:description" content="Two clips &amp; a photo">
+<meta property="og:description" content="ignored">
+</head><body>
+<video src='https://scontent-lga3-2.cdninstagram.com/o1/v/one.mp4?a=1&amp;b=2'></video>
+<video><source src="https://scontent-lga3-2.cdninstagram.com/o1/v/two.mp4"></video>
+<img src="https://scontent-lga3-1.cdninstagram.com/v/t51.2885-19/profile_150x150.jpg">
+<img alt="Photo" src="https://scontent-lga3-1.cdninstagram.com/v/t51.2885-15/3_1080x1080_n.jpg">
+</body></html>`
+
+	te := &ThreadsExtractor{cfg: DefaultConfig()}
+	got := te.mediaFromHTML(context.Background(), page)
+	if got == nil {
+		t.Fatal("expected a result")
+	}
+	if got.MediaURL != "https://scontent-lga3-2.cdninstagram.com/o1/v/one.mp4?a=1&b=2" || got.MediaType != "video" {
+		t.Errorf("media = %q (%s)", got.MediaURL, got.MediaType)
+	}
+	if got.Caption != "Two clips & a photo" {
+		t.Errorf("caption = %q", got.Caption)
+	}
+
+	var urls []string
+	for _, item := range got.Items {
+		urls = append(urls, item.URL)
+	}
+	if len(urls) != 3 || !strings.HasSuffix(urls[1], "two.mp4") || !strings.HasSuffix(urls[2], "3_1080x1080_n.jpg") {
+		t.Errorf("items = %v", urls)
+	}
+}
+
+func TestMediaFromHTMLSkipsVideoThumbnail(t *testing.T) {
+	// A video post whose player only gets a URL from JavaScript: og:image is the
+	// poster frame and must not be returned as the post's media
+	page := `<html><head>
+<meta property="og:image" content="https://scontent-lga3-1.cdninstagram.com/v/t51.2885-15/poster_1080x1080_n.jpg">
+</head><body><video playsinline src="blob:https://www.threads.net/1234"></video></body></html>`
+
+	te := &ThreadsExtractor{cfg: DefaultConfig()}
+	if got := te.mediaFromHTML(context.Background(), page); got != nil {
+		t.Errorf("expected no result, got %+v", got)
+	}
+}
+
+func TestExtractWithHTTPErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	te := &ThreadsExtractor{cfg: cfg, pageClient: newPageClient(), profiles: newProfileRotator(cfg.Browser)}
+	srv := newFixtureServer(t, loadFixtures(t))
+	te.rewriteURL = func(u string) string {
+		return strings.Replace(u, "https://www.threads.net", srv.URL, 1)
+	}
+
+	_, _, err := te.extractWithHTTP(context.Background(), "https://www.threads.net/@nobody/post/MISSING", defaultProfiles[0], nil)
+	if err == nil || errors.Is(err, errNoHTTPMedia) || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected the embed page's 404, got %v", err)
+	}
+}
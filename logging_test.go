@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var seen string
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFrom(r.Context())
+		loggerFrom(r.Context()).Info("inside handler")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated", "", false},
+		{"upstream ID kept", "edge-1234.abc_DEF", true},
+		{"invalid upstream ID replaced", "bad id\nwith newline", false},
+		{"overlong upstream ID replaced", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			r := httptest.NewRequest("GET", "/api/extract", nil)
+			if tt.incoming != "" {
+				r.Header.Set("X-Request-ID", tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			echoed := w.Header().Get("X-Request-ID")
+			if echoed == "" || echoed != seen {
+				t.Fatalf("echoed %q, handler saw %q", echoed, seen)
+			}
+			if tt.keep != (echoed == tt.incoming) {
+				t.Errorf("request ID = %q for incoming %q", echoed, tt.incoming)
+			}
+			if !validRequestID(echoed) {
+				t.Errorf("request ID %q is not valid", echoed)
+			}
+
+			// Both the handler's log line and the access log carry the ID
+			lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("expected 2 log lines, got %d: %s", len(lines), logs.String())
+			}
+			for _, line := range lines {
+				var entry map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatal(err)
+				}
+				if entry["request_id"] != echoed {
+					t.Errorf("log line %q lacks request_id %s", line, echoed)
+				}
+			}
+			if !strings.Contains(lines[1], `"status":418`) {
+				t.Errorf("access log = %s, want status 418", lines[1])
+			}
+		})
+	}
+}
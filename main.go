@@ -3,25 +3,35 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/launcher/flags"
 	"github.com/go-rod/rod/lib/proto"
 )
 
 // ExtractRequest represents the incoming request to extract media URL
 type ExtractRequest struct {
-	URL string `json:"url"`
+	URL     string `json:"url"`
+	Debug   bool   `json:"debug,omitempty"`   // Include a per-stage timings breakdown in the response
+	Archive bool   `json:"archive,omitempty"` // Copy the media into our storage and return its URL
 }
 
 // ExtractResponse represents the response with extracted media information
@@ -32,38 +42,101 @@ type ExtractResponse struct {
 	VideoID   string            `json:"videoId,omitempty"`
 	Title     string            `json:"title,omitempty"`
 	Duration  int64             `json:"duration,omitempty"`
-	VideoUrls map[string]string `json:"videoUrls,omitempty"` // Multiple video quality URLs
-	Metadata  map[string]string `json:"metadata,omitempty"`  // Additional extracted metadata
+	VideoUrls map[string]string `json:"videoUrls,omitempty"`    // Multiple video quality URLs
+	Metadata  map[string]string `json:"metadata,omitempty"`     // Additional extracted metadata
+	Caption   string            `json:"caption,omitempty"`      // Post text, from og:description
+	Thumbnail string            `json:"thumbnailUrl,omitempty"` // Preview image, from og:image
+	Items     []MediaItem       `json:"items,omitempty"`        // Every media item of the post, mediaUrl first
+	ID        string            `json:"extractionId,omitempty"` // Handle for /api/download/bundle
+	Archive   *ArchivedMedia    `json:"archive,omitempty"`      // Stored copy, archive mode only
+	Timings   []StageTiming     `json:"timings,omitempty"`      // Per-stage timings, debug mode only
+}
+
+// MediaItem is one image or clip of a post
+type MediaItem struct {
+	URL       string `json:"url"`
+	MediaType string `json:"mediaType"`
 }
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Success bool   `json:"success"`
+	Error   string        `json:"error"`
+	Code    string        `json:"code,omitempty"` // Page state Threads served instead of the post, e.g. rate_limited
+	Success bool          `json:"success"`
+	Timings []StageTiming `json:"timings,omitempty"` // Per-stage timings, debug mode only
 }
 
 // ThreadsExtractor handles the extraction logic
 type ThreadsExtractor struct {
-	browser *rod.Browser
+	cfg *Config
+
+	mu          sync.RWMutex // guards browser and launcher across relaunches
+	browser     *rod.Browser
+	launcher    *launcher.Launcher
+	relaunching atomic.Bool
+	pageSlots   chan struct{} // bounds concurrently open extraction pages
+	closed      sync.Once
+	pageClient  *http.Client // fetches post pages for the HTTP tier
+	profiles    *profileRotator
+	proxies     *proxyPool // nil without upstream proxies
+	blocks      *blockBackoff
+	debug       *debugStore      // nil unless debug artifacts are enabled
+	blockURLs   []*regexp.Regexp // compiled browser.blocking.urlPatterns
+
+	// rewriteURL, when set, maps the normalized post URL to the URL the browser
+	// actually navigates to. Tests use it to point the browser at local fixtures.
+	rewriteURL func(string) string
+
+	// observePage, when set, is handed the prepared page right before navigation.
+	// The returned func runs once extraction finishes, while the page is still
+	// open. The fixture recorder uses it to capture network traffic and HTML.
+	observePage func(ctx context.Context, page *rod.Page) func()
 }
 
 // NewThreadsExtractor creates a new extractor instance
-func NewThreadsExtractor() (*ThreadsExtractor, error) {
+func NewThreadsExtractor(cfg *Config) (*ThreadsExtractor, error) {
+	blockURLs, err := compileURLPatterns(cfg.Browser.Blocking.URLPatterns)
+	if err != nil {
+		return nil, err
+	}
+	browser, l, err := launchBrowser(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThreadsExtractor{
+		browser:    browser,
+		launcher:   l,
+		cfg:        cfg,
+		pageSlots:  make(chan struct{}, cfg.Browser.MaxPages),
+		pageClient: newPageClient(),
+		profiles:   newProfileRotator(cfg.Browser),
+		proxies:    newProxyPool(cfg),
+		blocks:     newBlockBackoff(cfg.Extraction),
+		debug:      newDebugStore(cfg.DebugArtifacts),
+		blockURLs:  blockURLs,
+	}, nil
+}
+
+// launchBrowser starts Chromium with the configured settings and connects to it
+func launchBrowser(cfg *Config) (*rod.Browser, *launcher.Launcher, error) {
 	// Configure launcher with optimized settings for faster performance
 	launcher := launcher.New().
-		Headless(true).
+		Headless(cfg.Browser.Headless).
 		NoSandbox(true).
-		Devtools(false).
-		Set("disable-gpu").
-		Set("disable-dev-shm-usage").
-		Set("disable-background-timer-throttling").
-		Set("disable-backgrounding-occluded-windows").
-		Set("disable-renderer-backgrounding").
-		Set("disable-features", "TranslateUI").
-		Set("disable-ipc-flooding-protection")
+		Devtools(false)
+
+	for _, f := range cfg.Browser.LauncherFlags {
+		name, value, hasValue := strings.Cut(f, "=")
+		if hasValue {
+			launcher = launcher.Set(flags.Flag(name), value)
+		} else {
+			launcher = launcher.Set(flags.Flag(name))
+		}
+	}
 
 	// Try to find Chrome/Chromium automatically for Windows
-	chromePath := os.Getenv("CHROME_PATH")
+	chromePath := cfg.Browser.ChromePath
 	if chromePath == "" {
 		// Common Chrome paths on Windows
 		commonPaths := []string{
@@ -87,31 +160,177 @@ func NewThreadsExtractor() (*ThreadsExtractor, error) {
 		launcher = launcher.Bin(chromePath)
 	}
 
-	// Add proxy support if environment variable is set
-	if proxy := os.Getenv("HTTP_PROXY"); proxy != "" {
-		launcher = launcher.Proxy(proxy)
-	}
-
 	// Launch browser with error handling
 	url, err := launcher.Launch()
 	if err != nil {
-		return nil, fmt.Errorf("failed to launch browser: %v", err)
+		return nil, nil, fmt.Errorf("failed to launch browser: %v", err)
+	}
+
+	browser := rod.New().ControlURL(url)
+	if err := browser.Connect(); err != nil {
+		launcher.Kill()
+		launcher.Cleanup()
+		return nil, nil, fmt.Errorf("failed to connect to browser: %v", err)
 	}
 
-	browser := rod.New().
-		ControlURL(url).
-		MustConnect()
+	return browser, launcher, nil
+}
 
-	return &ThreadsExtractor{
-		browser: browser,
-	}, nil
+// currentBrowser returns the live browser instance
+func (te *ThreadsExtractor) currentBrowser() *rod.Browser {
+	te.mu.RLock()
+	defer te.mu.RUnlock()
+	return te.browser
 }
 
-// Close cleans up the browser instance
-func (te *ThreadsExtractor) Close() {
-	if te.browser != nil {
-		te.browser.MustClose()
+// acquirePage waits for a free page slot and opens a blank page in it, going
+// through proxy when it isn't nil. The returned release func closes the page
+// and frees the slot.
+func (te *ThreadsExtractor) acquirePage(ctx context.Context, proxy *upstreamProxy) (*rod.Page, *blockedRequests, func(), error) {
+	select {
+	case te.pageSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, nil, fmt.Errorf("no free browser page: %w", ctx.Err())
+	}
+
+	page, dispose, err := te.newPage(proxy)
+	if err != nil {
+		<-te.pageSlots
+		return nil, nil, nil, err
+	}
+	blocked, stopIntercepting := te.interceptRequests(page, proxy)
+
+	metrics.pagesInFlight.Inc()
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			if stopIntercepting != nil {
+				stopIntercepting()
+			}
+			page.Close()
+			dispose()
+			metrics.pagesInFlight.Dec()
+			<-te.pageSlots
+		})
 	}
+	return page, blocked, release, nil
+}
+
+// PageCapacity reports how many extraction pages are open and the configured maximum
+func (te *ThreadsExtractor) PageCapacity() (inUse, capacity int) {
+	return len(te.pageSlots), cap(te.pageSlots)
+}
+
+// Relaunching reports whether the browser is currently being replaced
+func (te *ThreadsExtractor) Relaunching() bool {
+	return te.relaunching.Load()
+}
+
+// newPage opens a blank page, relaunching the browser once if it has died.
+// The returned func must run after the page is closed.
+func (te *ThreadsExtractor) newPage(proxy *upstreamProxy) (*rod.Page, func(), error) {
+	browser := te.currentBrowser()
+	page, dispose, err := openPage(browser, proxy)
+	if err == nil {
+		return page, dispose, nil
+	}
+
+	// A page failing to open is only worth a relaunch if the browser itself is gone
+	if _, verErr := browser.Version(); verErr == nil {
+		return nil, nil, err
+	}
+
+	slog.Warn("browser is unresponsive, relaunching", "error", err)
+	if relaunchErr := te.relaunch(browser); relaunchErr != nil {
+		return nil, nil, fmt.Errorf("browser unavailable: %v", relaunchErr)
+	}
+	return openPage(te.currentBrowser(), proxy)
+}
+
+// openPage opens a blank page in browser. A proxied page gets a browser
+// context of its own, since the proxy is a per-context setting; the returned
+// func disposes of that context.
+func openPage(browser *rod.Browser, proxy *upstreamProxy) (*rod.Page, func(), error) {
+	if proxy == nil {
+		page, err := browser.Page(proto.TargetCreateTarget{})
+		return page, func() {}, err
+	}
+
+	bc, err := proto.TargetCreateBrowserContext{DisposeOnDetach: true, ProxyServer: proxy.server()}.Call(browser)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create browser context for proxy %s: %v", proxy.label, err)
+	}
+	dispose := func() {
+		proto.TargetDisposeBrowserContext{BrowserContextID: bc.BrowserContextID}.Call(browser)
+	}
+
+	target, err := proto.TargetCreateTarget{URL: "about:blank", BrowserContextID: bc.BrowserContextID}.Call(browser)
+	if err != nil {
+		dispose()
+		return nil, nil, err
+	}
+	page, err := browser.PageFromTarget(target.TargetID)
+	if err != nil {
+		// Disposing of the context closes the target with it
+		dispose()
+		return nil, nil, err
+	}
+	return page, dispose, nil
+}
+
+// relaunch replaces a dead browser; concurrent callers seeing the same dead
+// instance only trigger one relaunch
+func (te *ThreadsExtractor) relaunch(dead *rod.Browser) error {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	if te.browser != dead {
+		// Someone else already relaunched
+		return nil
+	}
+
+	te.relaunching.Store(true)
+	defer te.relaunching.Store(false)
+
+	if te.launcher != nil {
+		te.launcher.Kill()
+		te.launcher.Cleanup()
+	}
+
+	browser, l, err := launchBrowser(te.cfg)
+	if err != nil {
+		return err
+	}
+
+	te.browser = browser
+	te.launcher = l
+	te.profiles.newSession()
+	metrics.browserRestarts.Inc()
+	slog.Info("browser relaunched")
+	return nil
+}
+
+// Close cleans up the browser instance and makes sure the Chromium process is gone.
+// It is safe to call more than once.
+func (te *ThreadsExtractor) Close() {
+	te.closed.Do(func() {
+		te.mu.Lock()
+		defer te.mu.Unlock()
+
+		te.proxies.Close()
+
+		if te.browser != nil {
+			if err := te.browser.Close(); err != nil {
+				slog.Warn("failed to close browser cleanly", "error", err)
+			}
+		}
+		if te.launcher != nil {
+			// Kill the whole process group in case the browser ignored the close request
+			te.launcher.Kill()
+			te.launcher.Cleanup()
+		}
+		slog.Info("browser shut down")
+	})
 }
 
 // normalizeURL removes query parameters and normalizes the Threads URL
@@ -148,14 +367,24 @@ func (te *ThreadsExtractor) normalizeURL(inputURL string) (string, error) {
 	return normalizedURL, nil
 }
 
-// extractMediaURL extracts the direct media URL from a Threads post
-func (te *ThreadsExtractor) extractMediaURL(threadsURL string) (result *ExtractResponse, err error) {
-	// Add panic recovery
+// extractMediaURL extracts the direct media URL from a Threads post, retrying
+// transient failures per extraction.retry.
+// Every step derives its deadline from ctx, so cancelling ctx (e.g. the client
+// disconnecting) aborts the extraction and closes the page right away.
+func (te *ThreadsExtractor) extractMediaURL(ctx context.Context, threadsURL string) (result *ExtractResponse, err error) {
+	start := time.Now()
+	strategy := "none"
 	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Panic in extractMediaURL: %v", r)
-			err = fmt.Errorf("extraction failed due to internal error")
-		}
+		outcome := extractionOutcome(ctx, err)
+		metrics.extractions.Inc(outcome, strategy)
+		metrics.extractionDuration.ObserveDuration(start, outcome)
+	}()
+
+	ctx, span := startSpan(ctx, "extract")
+	span.SetAttr("threads.url", threadsURL)
+	defer func() {
+		span.SetAttr("extract.strategy", strategy)
+		span.Finish(err)
 	}()
 
 	// Normalize the URL
@@ -164,74 +393,351 @@ func (te *ThreadsExtractor) extractMediaURL(threadsURL string) (result *ExtractR
 		return nil, err
 	}
 
+	retry := te.cfg.Extraction.Retry
+	budget := retry.budget(ctx, start)
+	var prev *extractAttempt
+	for n := 1; ; n++ {
+		att := te.nextAttempt(normalizedURL, n, prev)
+		result, err = te.extractAttempt(ctx, threadsURL, normalizedURL, att)
+		strategy = att.strategy
+		span.SetAttr("extract.attempts", n)
+		if err == nil || ctx.Err() != nil || n >= retry.MaxAttempts {
+			return result, err
+		}
+
+		reason := te.transientReason(err)
+		if reason == "" {
+			return nil, err
+		}
+		delay := retry.delay(n)
+		logger := loggerFrom(ctx).With("url", normalizedURL, "attempt", n, "reason", reason)
+		if time.Until(budget) < delay+retry.MinAttemptTime.Std() {
+			logger.Info("not retrying extraction, too little time left", "error", err)
+			return nil, err
+		}
+		metrics.extractionRetries.Inc(reason)
+		logger.Warn("extraction attempt failed, retrying", "error", err, "delay", delay.String())
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return nil, te.stepError(ctx, "wait to retry", sleepErr)
+		}
+		prev = att
+	}
+}
+
+// extractAttempt is one try of an extraction, with its own browser page.
+// It sets att.strategy to the strategy that produced the result.
+func (te *ThreadsExtractor) extractAttempt(ctx context.Context, threadsURL, normalizedURL string, att *extractAttempt) (result *ExtractResponse, err error) {
+	ctx, span := startSpan(ctx, "attempt")
+	span.SetAttr("attempt", att.number)
+	defer func() {
+		span.Finish(err)
+	}()
+
+	// Add panic recovery
+	defer func() {
+		if r := recover(); r != nil {
+			loggerFrom(ctx).Error("panic in extractMediaURL", "panic", r)
+			err = fmt.Errorf("extraction failed due to internal error")
+		}
+	}()
+
+	// One profile for every request of this attempt, HTTP tier included
+	profile, proxy := att.profile, att.proxy
+	span.SetAttr("browser.profile", profile.Name)
+	if proxy == nil {
+		// Without a proxy to switch to, a rate limit means waiting it out. Login
+		// walls and error pages can be specific to a post, so those still try.
+		if state, wait := te.blocks.active(directBackoffKey); wait > 0 && state == pageStateRateLimited {
+			return nil, &pageStateError{State: state, RetryAfter: wait}
+		}
+	}
+	logger := loggerFrom(ctx).With("url", normalizedURL, "profile", profile.Name, "attempt", att.number)
+	ctx = withLogger(ctx, logger)
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("extraction cancelled before start: %w", err)
+	}
+
+	// Most posts are server rendered, so a plain fetch avoids a browser page entirely
+	if te.cfg.Extraction.HTTPFirst {
+		httpCtx, stage := startSpan(ctx, "strategy.http")
+		var tier string
+		result, tier, err = te.extractWithHTTP(httpCtx, normalizedURL, profile, proxy)
+		stage.SetAttr("found", result != nil)
+		if result != nil {
+			stage.Finish(nil)
+			logger.Info("extraction succeeded", "strategy", tier, "media_type", result.MediaType, "media_url", result.MediaURL)
+			att.strategy = tier
+			return result, nil
+		}
+		stage.Finish(err)
+		if ctx.Err() != nil {
+			return nil, te.stepError(ctx, "HTTP extraction", ctx.Err())
+		}
+		logger.Debug("HTTP extraction found nothing, falling back to the browser", "error", err)
+		// The HTTP tier may have got the proxy ejected, which unsticks the post
+		proxy = te.proxies.pick(normalizedURL)
+		att.proxy = proxy
+	}
+
 	// Create a new page
-	page := te.browser.MustPage()
-	defer page.MustClose()
+	_, stage := startSpan(ctx, "open_page")
+	if proxy != nil {
+		stage.SetAttr("proxy", proxy.label)
+		logger.Debug("opening page through proxy", "proxy", proxy.label)
+	}
+	page, blocked, release, err := te.acquirePage(ctx, proxy)
+	if err != nil {
+		stage.Finish(err)
+		return nil, te.stepError(ctx, "open browser page", err)
+	}
+	defer release()
 
-	// Set user agent to avoid bot detection - use realistic desktop browser
-	userAgent := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
-	page.MustSetUserAgent(&proto.NetworkSetUserAgentOverride{
-		UserAgent: userAgent,
+	// Free the tab as soon as the caller gives up instead of waiting for step timeouts
+	stopWatch := context.AfterFunc(ctx, func() {
+		logger.Info("extraction cancelled, closing page", "cause", context.Cause(ctx))
+		page.Close()
 	})
+	defer stopWatch()
+
+	// Pose as the picked profile to avoid bot detection
+	err = profile.apply(page)
+	stage.Finish(err)
+	if err != nil {
+		return nil, te.stepError(ctx, "apply browser profile", err)
+	}
+
+	if te.observePage != nil {
+		defer te.observePage(ctx, page)()
+	}
 
-	// Set desktop viewport for better compatibility
-	page.MustSetViewport(1920, 1080, 1, false)
+	targetURL := normalizedURL
+	if te.rewriteURL != nil {
+		targetURL = te.rewriteURL(normalizedURL)
+	}
+	targetURL = profile.postURL(targetURL)
+
+	// With debug artifacts on, a failed extraction leaves the page behind for
+	// inspection. This runs before release, while the page is still open.
+	capture := te.startDebugCapture(ctx, page)
+	var signal, pageState string
+	defer func() {
+		if err != nil && ctx.Err() == nil {
+			capture.save(ctx, page, te.cfg.Extraction.AnalyzeTimeout.Std(), DebugCaptureInfo{
+				URL:         threadsURL,
+				TargetURL:   targetURL,
+				Error:       err.Error(),
+				ReadySignal: signal,
+				PageState:   pageState,
+				Profile:     profile.Name,
+				Proxy:       backoffKey(proxy),
+				Attempt:     att.number,
+			})
+		} else {
+			capture.discard()
+		}
+	}()
 
 	// Note: Rod has limited header support, focusing on user agent for bot detection avoidance
 
 	// Navigation with faster timeout for speed
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	navCtx, cancel := context.WithTimeout(ctx, te.cfg.Extraction.NavigationTimeout.Std())
 	defer cancel()
 
-	log.Printf("Fast navigation to: %s", normalizedURL)
-	err = page.Context(ctx).Navigate(normalizedURL)
-	if err != nil {
-		log.Printf("Navigation error: %v", err)
-		return nil, fmt.Errorf("failed to navigate to Threads post: %v", err)
+	ready := te.watchReadiness(navCtx, page)
+	logger.Debug("navigating", "target", targetURL)
+	navStart := time.Now()
+	_, stage = startSpan(ctx, "navigate")
+	err = page.Context(navCtx).Navigate(targetURL)
+	stage.Finish(err)
+	if err != nil && ctx.Err() == nil {
+		te.proxies.report(proxy, err)
 	}
-
-	// Wait for page load with timeout handling
-	err = page.Context(ctx).WaitLoad()
 	if err != nil {
-		log.Printf("Page load timeout, proceeding anyway: %v", err)
+		ready.cancel()
+		logger.Warn("navigation failed", "error", err)
+		return nil, te.stepError(ctx, "navigate to Threads post", err)
 	}
 
-	// Quick wait for essential JavaScript content to load
-	log.Printf("Quick wait for JavaScript content...")
-	time.Sleep(1 * time.Second)
-
-	// Wait for video elements with timeout
-	log.Printf("Looking for video elements...")
-	videoSelector := "video, [data-testid*='video'], [role='video'], video[src]"
-	err = page.Context(ctx).WaitElementsMoreThan(videoSelector, 0)
-	if err != nil {
-		log.Printf("No video elements found immediately, proceeding: %v", err)
+	// Wait for the first sign that there is something to extract (or never will be)
+	_, stage = startSpan(ctx, "wait_ready")
+	signal = ready.wait(page)
+	stage.SetAttr("ready.signal", signal)
+	stage.Finish(nil)
+	if ctx.Err() != nil {
+		return nil, te.stepError(ctx, "wait for page content", ctx.Err())
+	}
+	metrics.navigationDuration.ObserveDuration(navStart)
+	logger.Debug("page ready", "signal", signal, "duration_ms", time.Since(navStart).Milliseconds())
+
+	// Threads may have served a login wall, error or rate limit page instead of the post
+	_, stage = startSpan(ctx, "detect_page_state")
+	pageState = te.detectPageState(ctx, page)
+	stage.SetAttr("page.state", pageState)
+	stage.Finish(nil)
+	if pageState == "" {
+		te.proxies.report(proxy, nil)
+		te.blocks.reset(backoffKey(proxy))
 	} else {
-		// Quick additional wait only if elements found
-		time.Sleep(500 * time.Millisecond)
+		logger.Info("Threads served something other than the post", "state", pageState)
 	}
+	switch pageState {
+	case pageStateRateLimited, pageStateErrorPage:
+		// Nothing to extract from these
+		return nil, te.pageStateFailure(ctx, pageState, proxy)
+	}
+	// A login wall may still have the post behind it, and the embed page
+	// skips it, so the strategies get their chance first
 
 	// Prioritize DOM elements extraction for JavaScript-rendered content
-	log.Printf("Using DOM-based extraction for JavaScript-rendered Threads content")
-
-	if result := te.extractFromDOMElements(page, "video"); result != nil {
-		log.Printf("DOM extraction successful: %s (%s)", result.MediaType, result.MediaURL)
+	logger.Debug("trying DOM extraction")
+
+	domCtx, stage := startSpan(ctx, "strategy.dom")
+	result = te.extractFromDOMElements(domCtx, page, "video")
+	stage.SetAttr("found", result != nil)
+	stage.Finish(nil)
+	if result != nil {
+		logger.Info("extraction succeeded", "strategy", "dom", "media_type", result.MediaType, "media_url", result.MediaURL)
+		att.strategy = "dom"
+		te.collectPostDetails(ctx, page, result)
 		return result, nil
 	}
+	if ctx.Err() != nil {
+		return nil, te.stepError(ctx, "DOM extraction", ctx.Err())
+	}
 
 	// Fallback to enhanced source code search
-	log.Printf("DOM extraction failed, trying enhanced source code analysis")
-	if result := te.extractFromSourceCode(page, "video"); result != nil {
-		log.Printf("Source code extraction successful: %s (%s)", result.MediaType, result.MediaURL)
+	logger.Debug("DOM extraction found nothing, trying source code analysis")
+	sourceCtx, stage := startSpan(ctx, "strategy.source")
+	result = te.extractFromSourceCode(sourceCtx, page, "video")
+	stage.SetAttr("found", result != nil)
+	stage.Finish(nil)
+	if result != nil {
+		logger.Info("extraction succeeded", "strategy", "source", "media_type", result.MediaType, "media_url", result.MediaURL)
+		att.strategy = "source"
+		te.collectPostDetails(ctx, page, result)
 		return result, nil
 	}
+	if ctx.Err() != nil {
+		return nil, te.stepError(ctx, "source code extraction", ctx.Err())
+	}
 
+	// The player may have asked for the video even though nothing in the DOM shows it
+	result = te.mediaFromBlockedRequests(blocked)
+	logger.Debug("checked blocked requests", "blocked", blocked.count())
+	if result != nil {
+		logger.Info("extraction succeeded", "strategy", "network", "media_type", result.MediaType, "media_url", result.MediaURL)
+		att.strategy = "network"
+		te.collectPostDetails(ctx, page, result)
+		return result, nil
+	}
+
+	// The public /embed variant skips the login wall and renders just the post
+	if te.cfg.Extraction.EmbedFallback {
+		logger.Debug("source code analysis found nothing, trying the embed page")
+		embedCtx, stage := startSpan(ctx, "strategy.embed")
+		result = te.extractFromEmbedPage(embedCtx, page, targetURL)
+		stage.SetAttr("found", result != nil)
+		if result != nil {
+			stage.Finish(nil)
+			logger.Info("extraction succeeded", "strategy", "embed", "media_type", result.MediaType, "media_url", result.MediaURL)
+			att.strategy = "embed"
+			te.collectPostDetails(ctx, page, result)
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, te.stepError(ctx, "embed page extraction", ctx.Err())
+		}
+	}
+
+	if pageState != "" {
+		return nil, te.pageStateFailure(ctx, pageState, proxy)
+	}
 	return nil, fmt.Errorf("Threads extraction failed - unable to find media URLs in page source")
 }
 
+// collectPostDetails fills in the caption and every media item of the post
+// (carousels hold several). It is best effort: on failure result keeps just
+// its main media URL.
+func (te *ThreadsExtractor) collectPostDetails(parent context.Context, page *rod.Page, result *ExtractResponse) {
+	ctx, cancel := context.WithTimeout(parent, te.cfg.Extraction.DOMTimeout.Std())
+	defer cancel()
+	_, stage := startSpan(parent, "collect_items")
+
+	result.Items = []MediaItem{{URL: result.MediaURL, MediaType: result.MediaType}}
+	seen := map[string]bool{result.MediaURL: true}
+
+	res, err := page.Context(ctx).Eval(`() => ({
+		caption: (document.querySelector('meta[property="og:description"]') || {}).content || '',
+		thumbnail: (document.querySelector('meta[property="og:image"]') || {}).content ||
+			(Array.from(document.querySelectorAll('video')).map(v => v.poster).find(p => p) || ''),
+		videos: Array.from(document.querySelectorAll('video')).map(v => v.currentSrc || v.src || ''),
+		images: Array.from(document.querySelectorAll('img')).map(i => i.currentSrc || i.src || ''),
+	})`)
+	if err != nil {
+		loggerFrom(parent).Debug("failed to collect post details", "error", err)
+		stage.Finish(err)
+		return
+	}
+
+	result.Caption = strings.TrimSpace(res.Value.Get("caption").Str())
+	result.Thumbnail = res.Value.Get("thumbnail").Str()
+	for _, v := range res.Value.Get("videos").Arr() {
+		if u := v.Str(); !seen[u] && te.isValidVideoURL(u) {
+			seen[u] = true
+			result.Items = append(result.Items, MediaItem{URL: u, MediaType: "video"})
+		}
+	}
+	for _, v := range res.Value.Get("images").Arr() {
+		// Only full-size post images; thumbnails, avatars and video posters score lower
+		if u := v.Str(); !seen[u] && te.isValidImageURL(u) && !te.isValidVideoURL(u) && te.scoreImageURL(u) >= 100 {
+			seen[u] = true
+			result.Items = append(result.Items, MediaItem{URL: u, MediaType: "image"})
+		}
+	}
+	stage.SetAttr("items", len(result.Items))
+	stage.Finish(nil)
+}
+
+// extractionOutcome classifies an extraction result for metrics
+func extractionOutcome(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case ctx.Err() != nil:
+		return "cancelled"
+	default:
+		return "error"
+	}
+}
+
+// stepError wraps a failed extraction step, preferring the caller's cancellation as the cause
+func (te *ThreadsExtractor) stepError(ctx context.Context, step string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("extraction cancelled during %s: %w", step, ctxErr)
+	}
+	return fmt.Errorf("failed to %s: %w", step, err)
+}
+
+// sleepContext pauses for d or until ctx is done, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // analyzePageContent determines if the page contains video or image content
-func (te *ThreadsExtractor) analyzePageContent(page *rod.Page) string {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (te *ThreadsExtractor) analyzePageContent(parent context.Context, page *rod.Page) string {
+	logger := loggerFrom(parent)
+	ctx, cancel := context.WithTimeout(parent, te.cfg.Extraction.AnalyzeTimeout.Std())
 	defer cancel()
 
 	// Check for comprehensive video indicators
@@ -247,9 +753,9 @@ func (te *ThreadsExtractor) analyzePageContent(page *rod.Page) string {
 	for _, selector := range videoIndicators {
 		if meta, err := page.Context(ctx).Element(selector); err == nil {
 			if content, err := meta.Attribute("content"); err == nil && content != nil && *content != "" {
-				log.Printf("Found video indicator: %s = %s", selector, *content)
+				logger.Debug("found video indicator", "selector", selector, "content", *content)
 				if strings.Contains(*content, "video") || strings.Contains(*content, ".mp4") {
-					log.Printf("Detected video via meta tag: %s", selector)
+					logger.Debug("detected video via meta tag", "selector", selector)
 					return "video"
 				}
 			}
@@ -261,18 +767,18 @@ func (te *ThreadsExtractor) analyzePageContent(page *rod.Page) string {
 		for _, video := range videoElements {
 			// Check src attribute
 			if src, err := video.Attribute("src"); err == nil && src != nil && *src != "" {
-				log.Printf("Found video element with src: %s", *src)
+				logger.Debug("found video element with src", "src", *src)
 				if te.isValidVideoURL(*src) {
-					log.Printf("Detected video via video element src")
+					logger.Debug("detected video via video element src")
 					return "video"
 				}
 			}
 
 			// Check data-src attribute
 			if dataSrc, err := video.Attribute("data-src"); err == nil && dataSrc != nil && *dataSrc != "" {
-				log.Printf("Found video element with data-src: %s", *dataSrc)
+				logger.Debug("found video element with data-src", "src", *dataSrc)
 				if te.isValidVideoURL(*dataSrc) {
-					log.Printf("Detected video via video element data-src")
+					logger.Debug("detected video via video element data-src")
 					return "video"
 				}
 			}
@@ -281,9 +787,9 @@ func (te *ThreadsExtractor) analyzePageContent(page *rod.Page) string {
 			if sources, err := video.Elements("source"); err == nil {
 				for _, source := range sources {
 					if src, err := source.Attribute("src"); err == nil && src != nil && *src != "" {
-						log.Printf("Found video source: %s", *src)
+						logger.Debug("found video source", "src", *src)
 						if te.isValidVideoURL(*src) {
-							log.Printf("Detected video via source element")
+							logger.Debug("detected video via source element")
 							return "video"
 						}
 					}
@@ -315,14 +821,14 @@ func (te *ThreadsExtractor) analyzePageContent(page *rod.Page) string {
 		videoIndicatorFound := false
 		for _, pattern := range videoIndicatorPatterns {
 			if matched, _ := regexp.MatchString(pattern, html); matched {
-				log.Printf("Found video indicator pattern: %s", pattern)
+				logger.Debug("found video indicator pattern", "pattern", pattern)
 				videoIndicatorFound = true
 				break
 			}
 		}
 
 		if videoIndicatorFound {
-			log.Printf("Detected video via HTML video indicators - overriding content type detection")
+			logger.Debug("detected video via HTML video indicators")
 			return "video"
 		}
 
@@ -342,9 +848,9 @@ func (te *ThreadsExtractor) analyzePageContent(page *rod.Page) string {
 			re := regexp.MustCompile(pattern)
 			if matches := re.FindStringSubmatch(html); len(matches) > 1 {
 				url := matches[1]
-				log.Printf("Found video URL in HTML via pattern %s: %s", pattern, url)
+				logger.Debug("found video URL in HTML", "pattern", pattern, "url", url)
 				if te.isValidVideoURL(url) {
-					log.Printf("Detected video via HTML pattern analysis")
+					logger.Debug("detected video via HTML pattern analysis")
 					return "video"
 				}
 			}
@@ -354,10 +860,10 @@ func (te *ThreadsExtractor) analyzePageContent(page *rod.Page) string {
 	// Check og:image to confirm it's an image post
 	if imageMeta, err := page.Context(ctx).Element(`meta[property="og:image"]`); err == nil {
 		if content, err := imageMeta.Attribute("content"); err == nil && content != nil && *content != "" {
-			log.Printf("Found og:image: %s", *content)
+			logger.Debug("found og:image", "content", *content)
 			if strings.Contains(*content, ".jpg") || strings.Contains(*content, ".jpeg") ||
 				strings.Contains(*content, ".png") || strings.Contains(*content, ".webp") {
-				log.Printf("Detected image via og:image meta tag")
+				logger.Debug("detected image via og:image meta tag")
 				return "image"
 			}
 		}
@@ -376,69 +882,93 @@ func (te *ThreadsExtractor) analyzePageContent(page *rod.Page) string {
 			}
 		}
 		if imageCount > 0 {
-			log.Printf("Detected image via %d content images found", imageCount)
+			logger.Debug("detected image via content images", "count", imageCount)
 			return "image"
 		}
 	}
 
-	log.Printf("Could not determine content type, defaulting to image")
+	logger.Debug("could not determine content type, defaulting to image")
 	return "image"
 }
 
+// metaTag identifies a <meta> tag by its property or name attribute
+type metaTag struct {
+	attr  string // "property" or "name"
+	value string
+}
+
+// selector is the CSS selector matching the tag
+func (m metaTag) selector() string {
+	return fmt.Sprintf(`meta[%s="%s"]`, m.attr, m.value)
+}
+
+// Meta tags that carry the post media, most reliable first
+var (
+	videoMetaTags = []metaTag{
+		{"property", "og:video:url"},
+		{"property", "og:video"},
+		{"property", "og:video:secure_url"},
+		{"name", "twitter:player:stream"},
+	}
+	imageMetaTags = []metaTag{
+		{"property", "og:image"},
+		{"property", "og:image:url"},
+		{"name", "twitter:image"},
+	}
+)
+
 // extractFromMetaTags - fastest method, extracts from meta tags
-func (te *ThreadsExtractor) extractFromMetaTags(page *rod.Page, pageType string) *ExtractResponse {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+func (te *ThreadsExtractor) extractFromMetaTags(parent context.Context, page *rod.Page, pageType string) *ExtractResponse {
+	ctx, cancel := context.WithTimeout(parent, te.cfg.Extraction.MetaTagTimeout.Std())
 	defer cancel()
 
-	if pageType == "video" {
-		// ONLY extract video URLs for video content
-		videoSelectors := []string{
-			`meta[property="og:video:url"]`,
-			`meta[property="og:video"]`,
-			`meta[property="og:video:secure_url"]`,
-			`meta[name="twitter:player:stream"]`,
+	return te.mediaFromMetaTags(parent, pageType, func(tag metaTag) string {
+		meta, err := page.Context(ctx).Element(tag.selector())
+		if err != nil {
+			return ""
 		}
+		content, err := meta.Attribute("content")
+		if err != nil || content == nil {
+			return ""
+		}
+		return *content
+	})
+}
 
-		for _, selector := range videoSelectors {
-			if meta, err := page.Context(ctx).Element(selector); err == nil {
-				if content, err := meta.Attribute("content"); err == nil && content != nil && *content != "" {
-					url := *content
-					if te.isValidVideoURL(url) {
-						log.Printf("Meta tags found video URL: %s", url)
-						return &ExtractResponse{
-							MediaURL:  url,
-							MediaType: "video",
-							Success:   true,
-						}
-					}
+// mediaFromMetaTags picks the media URL out of the page's meta tags, read
+// through content. It is shared by the browser and the raw HTML paths.
+func (te *ThreadsExtractor) mediaFromMetaTags(ctx context.Context, pageType string, content func(metaTag) string) *ExtractResponse {
+	logger := loggerFrom(ctx)
+
+	if pageType == "video" {
+		// ONLY extract video URLs for video content
+		for _, tag := range videoMetaTags {
+			if url := content(tag); url != "" && te.isValidVideoURL(url) {
+				logger.Debug("meta tags found video URL", "url", url)
+				return &ExtractResponse{
+					MediaURL:  url,
+					MediaType: "video",
+					Success:   true,
 				}
 			}
 		}
 	} else {
 		// ONLY extract image URLs for image content - STRICT filtering
-		imageSelectors := []string{
-			`meta[property="og:image"]`,
-			`meta[property="og:image:url"]`,
-			`meta[name="twitter:image"]`,
-		}
-
-		for _, selector := range imageSelectors {
-			if meta, err := page.Context(ctx).Element(selector); err == nil {
-				if content, err := meta.Attribute("content"); err == nil && content != nil && *content != "" {
-					url := *content
-					// CRITICAL: Strictly validate this is an image URL
-					if te.isValidImageURL(url) && !te.isValidVideoURL(url) {
-						log.Printf("Meta tags found image URL: %s", url)
-						return &ExtractResponse{
-							MediaURL:  url,
-							MediaType: "image",
-							Success:   true,
-						}
-					} else {
-						log.Printf("Rejected URL as not a valid image: %s", url)
-					}
+		for _, tag := range imageMetaTags {
+			url := content(tag)
+			if url == "" {
+				continue
+			}
+			// CRITICAL: Strictly validate this is an image URL
+			if te.isValidImageURL(url) && !te.isValidVideoURL(url) {
+				logger.Debug("meta tags found image URL", "url", url)
+				return &ExtractResponse{
+					MediaURL:  url,
+					MediaType: "image",
+					Success:   true,
 				}
 			}
+			logger.Debug("rejected URL as not a valid image", "url", url)
 		}
 	}
 
@@ -446,12 +976,13 @@ func (te *ThreadsExtractor) extractFromMetaTags(page *rod.Page, pageType string)
 }
 
 // extractFromDOMElements - extracts from video/img elements in DOM (Enhanced for Threads)
-func (te *ThreadsExtractor) extractFromDOMElements(page *rod.Page, pageType string) *ExtractResponse {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (te *ThreadsExtractor) extractFromDOMElements(parent context.Context, page *rod.Page, pageType string) *ExtractResponse {
+	logger := loggerFrom(parent)
+	ctx, cancel := context.WithTimeout(parent, te.cfg.Extraction.DOMTimeout.Std())
 	defer cancel()
 
 	if pageType == "video" {
-		log.Printf("Searching for video elements in DOM...")
+		logger.Debug("searching for video elements in DOM")
 
 		// Optimized video element selectors for Threads (most common first)
 		videoSelectors := []string{
@@ -464,14 +995,14 @@ func (te *ThreadsExtractor) extractFromDOMElements(page *rod.Page, pageType stri
 
 		for _, selector := range videoSelectors {
 			if videoElements, err := page.Context(ctx).Elements(selector); err == nil && len(videoElements) > 0 {
-				log.Printf("Found %d video elements with %s", len(videoElements), selector)
+				logger.Debug("found video elements", "count", len(videoElements), "selector", selector)
 
 				for _, video := range videoElements {
 
 					// Check src attribute (most common)
 					if src, err := video.Attribute("src"); err == nil && src != nil && *src != "" {
 						if te.isValidVideoURL(*src) {
-							log.Printf("Fast DOM extraction: found video URL")
+							logger.Debug("DOM found video URL via src", "url", *src)
 							return &ExtractResponse{
 								MediaURL:  *src,
 								MediaType: "video",
@@ -482,9 +1013,9 @@ func (te *ThreadsExtractor) extractFromDOMElements(page *rod.Page, pageType stri
 
 					// Check data-video-url attribute
 					if dataVideoUrl, err := video.Attribute("data-video-url"); err == nil && dataVideoUrl != nil && *dataVideoUrl != "" {
-						log.Printf("Found data-video-url: %s", *dataVideoUrl)
+						logger.Debug("found data-video-url", "url", *dataVideoUrl)
 						if te.isValidVideoURL(*dataVideoUrl) {
-							log.Printf("DOM found valid video URL via data-video-url: %s", *dataVideoUrl)
+							logger.Debug("DOM found video URL via data-video-url", "url", *dataVideoUrl)
 							return &ExtractResponse{
 								MediaURL:  *dataVideoUrl,
 								MediaType: "video",
@@ -495,12 +1026,12 @@ func (te *ThreadsExtractor) extractFromDOMElements(page *rod.Page, pageType stri
 
 					// Check source elements within video
 					if sources, err := video.Elements("source"); err == nil {
-						log.Printf("Found %d source elements", len(sources))
+						logger.Debug("found source elements", "count", len(sources))
 						for j, source := range sources {
 							if src, err := source.Attribute("src"); err == nil && src != nil && *src != "" {
-								log.Printf("Found source[%d] src: %s", j, *src)
+								logger.Debug("found source src", "index", j, "src", *src)
 								if te.isValidVideoURL(*src) {
-									log.Printf("DOM found valid video URL via source: %s", *src)
+									logger.Debug("DOM found video URL via source", "url", *src)
 									return &ExtractResponse{
 										MediaURL:  *src,
 										MediaType: "video",
@@ -514,9 +1045,9 @@ func (te *ThreadsExtractor) extractFromDOMElements(page *rod.Page, pageType stri
 					// Execute JavaScript to get video currentSrc if available
 					if currentSrc, err := video.Eval(`() => this.currentSrc || this.src`); err == nil {
 						if srcStr := currentSrc.Value.String(); srcStr != "" {
-							log.Printf("Found video currentSrc via JavaScript: %s", srcStr)
+							logger.Debug("found video currentSrc", "src", srcStr)
 							if te.isValidVideoURL(srcStr) {
-								log.Printf("DOM found valid video URL via JavaScript currentSrc: %s", srcStr)
+								logger.Debug("DOM found video URL via currentSrc", "url", srcStr)
 								return &ExtractResponse{
 									MediaURL:  srcStr,
 									MediaType: "video",
@@ -527,11 +1058,11 @@ func (te *ThreadsExtractor) extractFromDOMElements(page *rod.Page, pageType stri
 					}
 				}
 			} else {
-				log.Printf("No elements found for selector: %s", selector)
+				logger.Debug("no elements found", "selector", selector)
 			}
 		}
 
-		log.Printf("No video URLs found in DOM elements")
+		logger.Debug("no video URLs found in DOM elements")
 	} else {
 		// ONLY look for images when page type is image - strict filtering
 		if imgElements, err := page.Context(ctx).Elements("img"); err == nil {
@@ -552,7 +1083,7 @@ func (te *ThreadsExtractor) extractFromDOMElements(page *rod.Page, pageType stri
 			}
 
 			if bestURL != "" && bestScore > 50 {
-				log.Printf("DOM found image URL: %s (score: %d)", bestURL, bestScore)
+				logger.Debug("DOM found image URL", "url", bestURL, "score", bestScore)
 				return &ExtractResponse{
 					MediaURL:  bestURL,
 					MediaType: "image",
@@ -566,19 +1097,29 @@ func (te *ThreadsExtractor) extractFromDOMElements(page *rod.Page, pageType stri
 }
 
 // extractFromSourceCode - analyzes page source for embedded media URLs
-func (te *ThreadsExtractor) extractFromSourceCode(page *rod.Page, pageType string) *ExtractResponse {
-	// Remove unused context for faster execution
-
+func (te *ThreadsExtractor) extractFromSourceCode(parent context.Context, page *rod.Page, pageType string) *ExtractResponse {
+	logger := loggerFrom(parent)
 	// Get page HTML content with quick timeout
-	quickCtx, quickCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	quickCtx, quickCancel := context.WithTimeout(parent, te.cfg.Extraction.SourceTimeout.Std())
 	defer quickCancel()
 
+	_, stage := startSpan(parent, "source.get_html")
 	html, err := page.Context(quickCtx).HTML()
+	stage.SetAttr("html.bytes", len(html))
+	stage.Finish(err)
 	if err != nil {
-		log.Printf("Failed to get HTML content quickly: %v", err)
+		logger.Warn("failed to get page HTML", "error", err)
 		return nil
 	}
 
+	return te.mediaFromSource(parent, html, pageType)
+}
+
+// mediaFromSource searches raw page HTML, including the JSON embedded in it,
+// for media URLs
+func (te *ThreadsExtractor) mediaFromSource(parent context.Context, html, pageType string) *ExtractResponse {
+	logger := loggerFrom(parent)
+
 	// ALWAYS check for video patterns first, regardless of detected pageType
 	// Threads-specific video patterns (priority order)
 	videoPatterns := []string{
@@ -608,7 +1149,9 @@ func (te *ThreadsExtractor) extractFromSourceCode(page *rod.Page, pageType strin
 	}
 
 	// Quick pattern search
-	log.Printf("Searching HTML patterns...")
+	logger.Debug("searching HTML patterns")
+	_, scan := startSpan(parent, "source.regex_scan")
+	defer scan.Finish(nil)
 
 	for _, pattern := range videoPatterns {
 		re := regexp.MustCompile(pattern)
@@ -624,7 +1167,7 @@ func (te *ThreadsExtractor) extractFromSourceCode(page *rod.Page, pageType strin
 
 					if te.isValidVideoURL(url) {
 						// Extract additional metadata
-						videoID, title, duration, videoUrls, metadata := te.extractVideoMetadata(html)
+						videoID, title, duration, videoUrls, metadata := te.extractVideoMetadata(parent, html)
 						return &ExtractResponse{
 							MediaURL:  url,
 							MediaType: "video",
@@ -663,9 +1206,9 @@ func (te *ThreadsExtractor) extractFromSourceCode(page *rod.Page, pageType strin
 				url = strings.ReplaceAll(url, "\\u0026", "&")
 				url = strings.ReplaceAll(url, "\\/", "/")
 
-				log.Printf("Found potential image URL: %s", url)
+				logger.Debug("found potential image URL", "url", url)
 				if te.isValidImageURL(url) && !te.isValidVideoURL(url) {
-					log.Printf("Valid image URL found: %s", url)
+					logger.Debug("valid image URL found", "url", url)
 					return &ExtractResponse{
 						MediaURL:  url,
 						MediaType: "image",
@@ -676,12 +1219,13 @@ func (te *ThreadsExtractor) extractFromSourceCode(page *rod.Page, pageType strin
 		}
 	}
 
-	log.Printf("No valid URLs found in source code for pageType: %s", pageType)
+	logger.Debug("no valid URLs found in source code", "page_type", pageType)
 	return nil
 }
 
 // extractVideoMetadata extracts video metadata and multiple URLs from HTML content
-func (te *ThreadsExtractor) extractVideoMetadata(html string) (string, string, int64, map[string]string, map[string]string) {
+func (te *ThreadsExtractor) extractVideoMetadata(ctx context.Context, html string) (string, string, int64, map[string]string, map[string]string) {
+	logger := loggerFrom(ctx)
 	var videoID, title string
 	var duration int64
 	videoUrls := make(map[string]string)
@@ -703,7 +1247,7 @@ func (te *ThreadsExtractor) extractVideoMetadata(html string) (string, string, i
 	if matches := metadataPatterns["video_id"].FindStringSubmatch(html); len(matches) > 1 {
 		videoID = matches[1]
 		metadata["video_id"] = videoID
-		log.Printf("Extracted video ID: %s", videoID)
+		logger.Debug("extracted video ID", "video_id", videoID)
 	}
 
 	// Extract title
@@ -713,7 +1257,7 @@ func (te *ThreadsExtractor) extractVideoMetadata(html string) (string, string, i
 		title = strings.ReplaceAll(title, " | Facebook", "")
 		title = strings.ReplaceAll(title, " - Facebook", "")
 		metadata["title"] = title
-		log.Printf("Extracted title: %s", title)
+		logger.Debug("extracted title", "title", title)
 	}
 
 	// Extract duration (convert from milliseconds to seconds)
@@ -721,7 +1265,7 @@ func (te *ThreadsExtractor) extractVideoMetadata(html string) (string, string, i
 		if durationMs, err := strconv.ParseInt(matches[1], 10, 64); err == nil {
 			duration = durationMs / 1000 // Convert to seconds
 			metadata["duration"] = fmt.Sprintf("%d seconds", duration)
-			log.Printf("Extracted duration: %d seconds", duration)
+			logger.Debug("extracted duration", "seconds", duration)
 		}
 	}
 
@@ -730,7 +1274,7 @@ func (te *ThreadsExtractor) extractVideoMetadata(html string) (string, string, i
 		url := strings.ReplaceAll(matches[1], "\\u0026", "&")
 		url = strings.ReplaceAll(url, "\\/", "/")
 		videoUrls["browser_hd"] = url
-		log.Printf("Extracted browser HD URL: %s", url)
+		logger.Debug("extracted browser HD URL", "url", url)
 	}
 
 	// Extract browser SD URL
@@ -738,7 +1282,7 @@ func (te *ThreadsExtractor) extractVideoMetadata(html string) (string, string, i
 		url := strings.ReplaceAll(matches[1], "\\u0026", "&")
 		url = strings.ReplaceAll(url, "\\/", "/")
 		videoUrls["browser_sd"] = url
-		log.Printf("Extracted browser SD URL: %s", url)
+		logger.Debug("extracted browser SD URL", "url", url)
 	}
 
 	// Extract HD source
@@ -746,7 +1290,7 @@ func (te *ThreadsExtractor) extractVideoMetadata(html string) (string, string, i
 		url := strings.ReplaceAll(matches[1], "\\u0026", "&")
 		url = strings.ReplaceAll(url, "\\/", "/")
 		videoUrls["hd_src"] = url
-		log.Printf("Extracted HD source: %s", url)
+		logger.Debug("extracted HD source", "url", url)
 	}
 
 	// Extract SD source
@@ -754,7 +1298,7 @@ func (te *ThreadsExtractor) extractVideoMetadata(html string) (string, string, i
 		url := strings.ReplaceAll(matches[1], "\\u0026", "&")
 		url = strings.ReplaceAll(url, "\\/", "/")
 		videoUrls["sd_src"] = url
-		log.Printf("Extracted SD source: %s", url)
+		logger.Debug("extracted SD source", "url", url)
 	}
 
 	// Extract playable URL
@@ -762,7 +1306,7 @@ func (te *ThreadsExtractor) extractVideoMetadata(html string) (string, string, i
 		url := strings.ReplaceAll(matches[1], "\\u0026", "&")
 		url = strings.ReplaceAll(url, "\\/", "/")
 		videoUrls["playable_url"] = url
-		log.Printf("Extracted playable URL: %s", url)
+		logger.Debug("extracted playable URL", "url", url)
 	}
 
 	return videoID, title, duration, videoUrls, metadata
@@ -785,7 +1329,7 @@ func (te *ThreadsExtractor) isValidVideoURL(url string) bool {
 	if strings.Contains(url, ".mp4") || strings.Contains(url, ".webm") ||
 		strings.Contains(url, ".mov") || strings.Contains(url, ".m4v") ||
 		strings.Contains(url, ".avi") || strings.Contains(url, ".mkv") {
-		log.Printf("Valid video URL by extension: %s", url)
+		slog.Debug("valid video URL by extension", "url", url)
 		return true
 	}
 
@@ -799,14 +1343,14 @@ func (te *ThreadsExtractor) isValidVideoURL(url string) bool {
 
 	for _, cdn := range facebookVideoCDNs {
 		if strings.Contains(url, cdn) {
-			log.Printf("Valid video URL by Facebook CDN pattern: %s", url)
+			slog.Debug("valid video URL by Facebook CDN pattern", "url", url)
 			return true
 		}
 	}
 
 	// Check for Threads video patterns (highest priority)
 	if strings.Contains(url, "cdninstagram.com") {
-		log.Printf("Valid video URL by Threads CDN: %s", url)
+		slog.Debug("valid video URL by Threads CDN", "url", url)
 		return true
 	}
 
@@ -814,7 +1358,7 @@ func (te *ThreadsExtractor) isValidVideoURL(url string) bool {
 	if strings.Contains(url, "fbcdn.net") || strings.Contains(url, "scontent") {
 		// More specific check for video indicators
 		if strings.Contains(url, "video") || strings.Contains(url, ".mp4") {
-			log.Printf("Valid video URL by Facebook CDN pattern: %s", url)
+			slog.Debug("valid video URL by Facebook CDN pattern", "url", url)
 			return true
 		}
 	}
@@ -825,13 +1369,13 @@ func (te *ThreadsExtractor) isValidVideoURL(url string) bool {
 		videoKeywords := []string{"video", "playable", "stream", "media", ".mp4", ".webm", ".mov"}
 		for _, keyword := range videoKeywords {
 			if strings.Contains(url, keyword) {
-				log.Printf("Valid video URL by keyword '%s': %s", keyword, url)
+				slog.Debug("valid video URL by keyword", "keyword", keyword, "url", url)
 				return true
 			}
 		}
 	}
 
-	log.Printf("URL rejected as not a valid video: %s", url)
+	slog.Debug("URL rejected as not a valid video", "url", url)
 	return false
 }
 
@@ -897,10 +1441,11 @@ func (te *ThreadsExtractor) scoreImageURL(url string) int {
 }
 
 // fallbackExtraction - simpler extraction when all strategies fail
-func (te *ThreadsExtractor) fallbackExtraction(page *rod.Page, pageType string) *ExtractResponse {
-	log.Printf("Starting fallback extraction for %s content", pageType)
+func (te *ThreadsExtractor) fallbackExtraction(parent context.Context, page *rod.Page, pageType string) *ExtractResponse {
+	logger := loggerFrom(parent)
+	logger.Debug("starting fallback extraction", "page_type", pageType)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(parent, te.cfg.Extraction.FallbackTimeout.Std())
 	defer cancel()
 
 	if pageType == "image" {
@@ -909,7 +1454,7 @@ func (te *ThreadsExtractor) fallbackExtraction(page *rod.Page, pageType string)
 			for _, img := range imgElements {
 				if src, err := img.Attribute("src"); err == nil && src != nil && *src != "" {
 					url := *src
-					log.Printf("Checking image URL: %s", url)
+					logger.Debug("checking image URL", "url", url)
 
 					// More lenient validation for fallback
 					if strings.Contains(url, "cdninstagram.com") || strings.Contains(url, "fbcdn.net") {
@@ -918,7 +1463,7 @@ func (te *ThreadsExtractor) fallbackExtraction(page *rod.Page, pageType string)
 							!strings.Contains(url, "avatar") &&
 							!strings.Contains(url, "logo") &&
 							!strings.Contains(url, ".mp4") {
-							log.Printf("Fallback found image: %s", url)
+							logger.Debug("fallback found image", "url", url)
 							return &ExtractResponse{
 								MediaURL:  url,
 								MediaType: "image",
@@ -935,7 +1480,7 @@ func (te *ThreadsExtractor) fallbackExtraction(page *rod.Page, pageType string)
 			for _, video := range videoElements {
 				if src, err := video.Attribute("src"); err == nil && src != nil && *src != "" {
 					url := *src
-					log.Printf("Fallback found video: %s", url)
+					logger.Debug("fallback found video", "url", url)
 					return &ExtractResponse{
 						MediaURL:  url,
 						MediaType: "video",
@@ -946,25 +1491,18 @@ func (te *ThreadsExtractor) fallbackExtraction(page *rod.Page, pageType string)
 		}
 	}
 
-	log.Printf("Fallback extraction failed")
+	logger.Debug("fallback extraction failed")
 	return nil
 }
 
-// handleExtract handles the API endpoint for extracting media URLs
-func handleExtract(te *ThreadsExtractor) http.HandlerFunc {
+// handleExtract handles extraction requests. archiver is nil when no storage
+// backend is configured, in which case archive mode is rejected. Successful
+// results are kept in cache for /api/download/bundle.
+func handleExtract(te *ThreadsExtractor, archiver *mediaArchiver, cache *extractionCache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "https://threadsvid.com")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		logger := loggerFrom(r.Context())
 		w.Header().Set("Content-Type", "application/json")
 
-		// Handle preflight request
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
 		if r.Method != "POST" {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			json.NewEncoder(w).Encode(ErrorResponse{
@@ -976,6 +1514,7 @@ func handleExtract(te *ThreadsExtractor) http.HandlerFunc {
 
 		var req ExtractRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			recordError(r)
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(ErrorResponse{
 				Error:   "Invalid JSON payload",
@@ -985,6 +1524,7 @@ func handleExtract(te *ThreadsExtractor) http.HandlerFunc {
 		}
 
 		if req.URL == "" {
+			recordError(r)
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(ErrorResponse{
 				Error:   "URL is required",
@@ -993,37 +1533,96 @@ func handleExtract(te *ThreadsExtractor) http.HandlerFunc {
 			return
 		}
 
-		// Extract media URL
-		result, err := te.extractMediaURL(req.URL)
-		if err != nil {
-			log.Printf("Extraction error for URL %s: %v", req.URL, err)
+		archive := req.Archive || r.URL.Query().Get("archive") == "true"
+		if archive && archiver == nil {
+			recordError(r)
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(ErrorResponse{
-				Error:   err.Error(),
+				Error:   "Archive mode is not enabled on this server",
 				Success: false,
 			})
 			return
 		}
 
+		// Debug mode records every span of this request so it can be returned as timings
+		ctx := r.Context()
+		var recorder *spanRecorder
+		if req.Debug || r.URL.Query().Get("debug") == "1" {
+			ctx, recorder = withSpanRecorder(ctx)
+		}
+
+		// Extract media URL, bound to the client's request so a disconnect stops the work
+		result, err := te.extractMediaURL(ctx, req.URL)
+		if err != nil {
+			if r.Context().Err() != nil {
+				// Client went away, there is nobody left to answer
+				logger.Info("client disconnected during extraction", "url", req.URL, "error", err)
+				return
+			}
+			logger.Warn("extraction failed", "url", req.URL, "error", err)
+			recordError(r)
+			status, code := extractErrorStatus(err)
+			resp := ErrorResponse{
+				Error:   err.Error(),
+				Code:    code,
+				Success: false,
+			}
+			if recorder != nil {
+				resp.Timings = recorder.Timings()
+			}
+			setRetryAfter(w, err)
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		if archive {
+			// Signed CDN URLs expire, so hand out our stored copy instead
+			media, err := archiver.archive(ctx, result.MediaURL)
+			if err != nil {
+				if r.Context().Err() != nil {
+					logger.Info("client disconnected during archiving", "url", req.URL, "error", err)
+					return
+				}
+				logger.Warn("archiving failed", "url", req.URL, "media_url", result.MediaURL, "error", err)
+				recordError(r)
+				resp := ErrorResponse{
+					Error:   fmt.Sprintf("failed to archive media: %v", err),
+					Success: false,
+				}
+				if recorder != nil {
+					resp.Timings = recorder.Timings()
+				}
+				w.WriteHeader(http.StatusBadGateway)
+				json.NewEncoder(w).Encode(resp)
+				return
+			}
+			logger.Info("media archived", "key", media.Key, "bytes", media.Size, "deduplicated", media.Deduplicated)
+			result.Archive = media
+			result.MediaURL = media.URL
+		}
+
+		if normalized, err := te.normalizeURL(req.URL); err == nil {
+			result.ID = cache.put(normalized, result)
+		}
+
+		if recorder != nil {
+			result.Timings = recorder.Timings()
+		}
+
+		recordExtraction(r)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(result)
 	}
 }
 
-// handleDownload handles media download requests with CORS support
-func handleDownload() http.HandlerFunc {
+// handleDownload handles media download requests. When format, start, end or
+// height are given the media is processed with ffmpeg first; tc is nil when
+// ffmpeg isn't installed. Media is fetched through the upstream proxies.
+func handleDownload(cfg DownloadConfig, proxies *proxyPool, tc *transcoder) http.HandlerFunc {
+	fetcher := newMediaFetcher(cfg, proxies)
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "https://threadsvid.com")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		// Handle preflight request
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
+		logger := loggerFrom(r.Context())
 		if r.Method != "GET" {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
@@ -1034,31 +1633,39 @@ func handleDownload() http.HandlerFunc {
 		filename := r.URL.Query().Get("filename")
 
 		if mediaURL == "" {
+			recordError(r)
+			metrics.downloadResponses.Inc(strconv.Itoa(http.StatusBadRequest))
 			http.Error(w, "URL parameter is required", http.StatusBadRequest)
 			return
 		}
 
-		log.Printf("Proxying download request for: %s", mediaURL)
-
-		// Create HTTP client with timeout
-		client := &http.Client{
-			Timeout: 30 * time.Second,
-		}
-
-		// Fetch the media file
-		resp, err := client.Get(mediaURL)
+		opts, err := parseTranscodeOptions(r.URL.Query())
 		if err != nil {
-			log.Printf("Failed to fetch media: %v", err)
-			http.Error(w, "Failed to fetch media", http.StatusInternalServerError)
+			recordError(r)
+			metrics.downloadResponses.Inc(strconv.Itoa(http.StatusBadRequest))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if opts.Active() {
+			if tc == nil {
+				recordError(r)
+				metrics.downloadResponses.Inc(strconv.Itoa(http.StatusNotImplemented))
+				http.Error(w, "Media processing is not available on this server", http.StatusNotImplemented)
+				return
+			}
+			serveTranscoded(w, r, fetcher, tc, mediaURL, filename, opts)
 			return
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Media fetch failed with status: %d", resp.StatusCode)
-			http.Error(w, "Media not found", http.StatusNotFound)
+		logger.Info("proxying download", "media_url", mediaURL)
+
+		// Fetch the media file, aborting the upstream fetch if the client disconnects
+		resp, err := fetcher.open(r.Context(), mediaURL)
+		if err != nil {
+			writeFetchError(w, r, err)
 			return
 		}
+		defer resp.Body.Close()
 
 		// Set headers for download
 		if filename != "" {
@@ -1068,59 +1675,195 @@ func handleDownload() http.HandlerFunc {
 		w.Header().Set("Content-Length", resp.Header.Get("Content-Length"))
 
 		// Stream the content
-		_, err = io.Copy(w, resp.Body)
+		metrics.downloadResponses.Inc(strconv.Itoa(http.StatusOK))
+		written, err := io.Copy(w, resp.Body)
+		recordBytesProxied(r, written)
+		metrics.proxiedBytes.Add(float64(written))
 		if err != nil {
-			log.Printf("Failed to stream media: %v", err)
+			logger.Warn("failed to stream media", "error", err)
+			recordError(r)
 			return
 		}
 
-		log.Printf("Successfully proxied download for: %s", filename)
+		logger.Info("proxied download", "filename", filename, "bytes", written)
+	}
+}
+
+// writeFetchError answers a failed media fetch with the matching status
+func writeFetchError(w http.ResponseWriter, r *http.Request, err error) {
+	logger := loggerFrom(r.Context())
+	recordError(r)
+
+	var statusErr *mediaStatusError
+	switch {
+	case errors.Is(err, errInvalidMediaURL):
+		metrics.downloadResponses.Inc(strconv.Itoa(http.StatusBadRequest))
+		http.Error(w, "Invalid media URL", http.StatusBadRequest)
+	case errors.As(err, &statusErr):
+		logger.Warn("media fetch failed", "status", statusErr.status)
+		metrics.downloadResponses.Inc(strconv.Itoa(http.StatusNotFound))
+		http.Error(w, "Media not found", http.StatusNotFound)
+	default:
+		logger.Warn("failed to fetch media", "error", err)
+		metrics.downloadResponses.Inc(strconv.Itoa(http.StatusInternalServerError))
+		http.Error(w, "Failed to fetch media", http.StatusInternalServerError)
 	}
 }
 
 // serveStaticFiles serves the frontend files
-func serveStaticFiles() {
-	fs := http.FileServer(http.Dir("."))
-	http.Handle("/", fs)
+func serveStaticFiles(mux *http.ServeMux, dir string) {
+	fs := http.FileServer(http.Dir(dir))
+	mux.Handle("/", fs)
 }
 
 func main() {
+	// Subcommands; anything else, including no arguments, runs the server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "download":
+			os.Exit(runDownload(os.Args[2:]))
+		case "extract":
+			os.Exit(runExtract(os.Args[2:]))
+		case "record":
+			os.Exit(runRecord(os.Args[2:]))
+		}
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cf := registerConfigFlags(fs)
+	fs.Parse(os.Args[1:])
+
+	cfg, err := cf.resolve(fs, os.Getenv)
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+
+	if err := setupLogging(cfg.Log, os.Stderr); err != nil {
+		log.Fatalf("Logging setup error: %v", err)
+	}
+
+	if cf.printConfig {
+		if err := cfg.WriteYAML(os.Stdout); err != nil {
+			log.Fatalf("Failed to print config: %v", err)
+		}
+		return
+	}
+
+	// Load API keys if configured, otherwise the API stays open
+	var keys *APIKeyStore
+	if cfg.Auth.KeysFile != "" {
+		keys, err = LoadAPIKeys(cfg.Auth.KeysFile)
+		if err != nil {
+			slog.Error("failed to load API keys", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("API key authentication enabled", "keys", len(keys.keys))
+	}
+
 	// Initialize the Threads extractor
-	extractor, err := NewThreadsExtractor()
+	extractor, err := NewThreadsExtractor(cfg)
 	if err != nil {
-		log.Fatalf("Failed to initialize Threads extractor: %v", err)
+		slog.Error("failed to initialize Threads extractor", "error", err)
+		os.Exit(1)
 	}
+	// From here on nothing may call os.Exit, the browser must always be torn down
 	defer extractor.Close()
 
+	cors := cfg.CORS
+	slog.Info("CORS policy loaded", "allowed_origins", cors.AllowedOrigins)
+
 	// Setup routes
-	serveStaticFiles()
-	http.HandleFunc("/api/extract", handleExtract(extractor))
-	http.HandleFunc("/api/download", handleDownload())
-
-	// Health check endpoint
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "https://threadsvid.com")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Content-Type", "application/json")
+	mux := http.NewServeMux()
+	if cfg.Server.StaticDir != "" {
+		serveStaticFiles(mux, cfg.Server.StaticDir)
+	}
+	// Archive mode stores media server-side; it stays off without a backend
+	var archiver *mediaArchiver
+	storage, err := NewStorage(cfg.Storage)
+	if err != nil {
+		slog.Error("failed to initialize storage", "error", err)
+		return
+	}
+	if storage != nil {
+		archiver = &mediaArchiver{fetcher: newMediaFetcher(cfg.Download, extractor.proxies), storage: storage}
+		if local, ok := storage.(*localStorage); ok && strings.HasPrefix(local.baseURL, "/") {
+			mux.HandleFunc(local.baseURL+"/", withCORS(cors, local.Handler().ServeHTTP))
+		}
+		slog.Info("archive mode enabled", "backend", cfg.Storage.Backend)
+	}
 
-		json.NewEncoder(w).Encode(map[string]string{
-			"status": "healthy",
-			"time":   time.Now().Format(time.RFC3339),
-		})
-	})
+	// Download processing needs ffmpeg, found like the browser binary
+	tc := newTranscoder(cfg.FFmpeg)
+	if tc != nil {
+		slog.Info("media processing enabled", "ffmpeg", tc.path)
+	} else {
+		slog.Info("ffmpeg not found, media processing disabled")
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	extractions := newExtractionCache(time.Hour, 1000)
+	mux.HandleFunc("/api/extract", withCORS(cors, requireAPIKey(keys, handleExtract(extractor, archiver, extractions))))
+	mux.HandleFunc("/api/download", withCORS(cors, requireAPIKey(keys, handleDownload(cfg.Download, extractor.proxies, tc))))
+	mux.HandleFunc("/api/oembed", withCORS(cors, requireAPIKey(keys, handleOEmbed(extractor, cfg.Download))))
+	mux.HandleFunc("/api/download/bundle", withCORS(cors, requireAPIKey(keys, handleDownloadBundle(extractor, extractions, cfg.Download))))
+	mux.HandleFunc("/api/admin/usage", requireAdminKey(keys, handleAdminUsage(keys)))
+	mux.HandleFunc("/api/admin/debug", requireAdminKey(keys, handleAdminDebug(extractor.debug)))
+	mux.HandleFunc("/api/admin/debug/", requireAdminKey(keys, handleAdminDebug(extractor.debug)))
+	mux.HandleFunc("/metrics", handleMetrics(metrics))
+
+	// Health check endpoints: liveness never touches the browser, readiness does
+	readinessChecks := []readinessCheck{
+		browserCheck(extractor),
+		pageCapacityCheck(extractor),
+	}
+	if extractor.proxies != nil {
+		readinessChecks = append(readinessChecks, proxyPoolCheck(extractor.proxies))
+	}
+	if storage != nil {
+		readinessChecks = append(readinessChecks, storageCheck(storage, cfg.Storage.Backend))
+	}
+	mux.HandleFunc("/healthz", handleHealthz())
+	mux.HandleFunc("/readyz", handleReadyz(readinessChecks, cfg.Server.ReadinessTimeout.Std()))
+	// Kept for existing frontends that poll /health
+	mux.HandleFunc("/health", withCORS(cors, handleHealthz()))
+
+	slog.Info("Threads Video Downloader server starting",
+		"addr", cfg.Addr(),
+		"extract_endpoint", fmt.Sprintf("http://%s/api/extract", cfg.Addr()),
+		"log_level", cfg.Log.Level,
+	)
+
+	// Install the span exporter, tracing stays a no-op without an endpoint
+	if cfg.Tracing.Endpoint != "" {
+		exporter := newOTLPExporter(cfg.Tracing)
+		tracer = &Tracer{exporter: exporter}
+		slog.Info("tracing enabled", "endpoint", cfg.Tracing.Endpoint, "service", cfg.Tracing.ServiceName)
+		defer func() {
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := exporter.Shutdown(flushCtx); err != nil {
+				slog.Warn("failed to flush spans", "error", err)
+			}
+		}()
 	}
 
-	log.Printf("Threads Video Downloader server starting on port %s", port)
-	log.Printf("Frontend available at: http://0.0.0.0:%s", port)
-	log.Printf("API endpoint: http://0.0.0.0:%s/api/extract", port)
+	drain := &drainState{}
+	srv := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           withRequestID(withTracing(drain.middleware(mux))),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		// Restore default signal handling so a second signal exits immediately;
+		// leakless still reaps the browser process in that case
+		<-ctx.Done()
+		stop()
+	}()
 
-	if err := http.ListenAndServe("0.0.0.0:"+port, nil); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	if err := runServer(ctx, srv, drain, cfg.Server.ShutdownTimeout.Std()); err != nil {
+		slog.Error("server stopped with error", "error", err)
 	}
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	te := &ThreadsExtractor{}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"net with query", "https://www.threads.net/@user/post/ABC123?xmt=AQG", "https://www.threads.net/@user/post/ABC123", false},
+		{"com domain", "https://threads.com/@user.name/post/C1-x_y", "https://www.threads.net/@user.name/post/C1-x_y", false},
+		{"mobile domain", "https://m.threads.net/@user/post/ABC123/", "https://www.threads.net/@user/post/ABC123/", false},
+		{"other domain", "https://www.instagram.com/@user/post/ABC123", "", true},
+		{"profile not post", "https://www.threads.net/@user", "", true},
+		{"garbage", "://not a url", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := te.normalizeURL(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeURL(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValidVideoURL(t *testing.T) {
+	te := &ThreadsExtractor{}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"", false},
+		{"https://scontent-lga3-2.cdninstagram.com/o1/v/t16/f1/m82/clip.mp4?efg=1", true},
+		{"https://video.xx.fbcdn.net/v/t42.1790-2/clip", true},
+		{"https://scontent-video.fbcdn.net/v/stream", true},
+		{"https://instagram.flga1-1.fna.fbcdn.net/o1/v/t16/playable", true},
+		{"https://example.com/movie.webm", true},
+		{"https://scontent-lga3-1.cdninstagram.com/v/t51.2885-15/photo_1080x1080_n.jpg", false},
+		{"https://scontent.cdninstagram.com/v/t51/thumb.webp", false},
+		{"https://example.com/page", false},
+		{"https://static.cdninstagram.com/rsrc.php/v3/script", true}, // any Threads CDN URL without an image extension passes
+	}
+
+	for _, tt := range tests {
+		if got := te.isValidVideoURL(tt.url); got != tt.want {
+			t.Errorf("isValidVideoURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidImageURL(t *testing.T) {
+	te := &ThreadsExtractor{}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"", false},
+		{"https://scontent-lga3-1.cdninstagram.com/v/t51.2885-15/412345680_1080x1080_n.jpg?stp=dst-jpg", true},
+		{"https://scontent.xx.fbcdn.net/v/t39/photo.webp", true},
+		{"https://scontent-lga3-1.cdninstagram.com/v/t51.2885-19/profile_150x150.jpg", false},
+		{"https://scontent.cdninstagram.com/v/t51/avatar.png", false},
+		{"https://scontent.cdninstagram.com/o1/v/t16/clip.mp4", false},
+		{"https://scontent.cdninstagram.com/v/video_thumb.jpg", false},
+		{"https://example.com/photo.jpg", false},
+		{"https://scontent.cdninstagram.com/v/t51/no-extension", false},
+	}
+
+	for _, tt := range tests {
+		if got := te.isValidImageURL(tt.url); got != tt.want {
+			t.Errorf("isValidImageURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestScoreImageURL(t *testing.T) {
+	te := &ThreadsExtractor{}
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"https://example.com/photo.jpg", 0},
+		{"https://scontent.cdninstagram.com/v/t51/photo.jpg", 50},
+		{"https://scontent.cdninstagram.com/v/t51/p640x640/photo_640x640.jpg", 70},
+		{"https://scontent.cdninstagram.com/v/t51/photo_720x720.jpg", 80},
+		{"https://scontent.cdninstagram.com/v/t51/photo_1080x1080.jpg", 100},
+		{"https://scontent.cdninstagram.com/v/t51/full_res_1080x1080.jpg", 125},
+	}
+
+	for _, tt := range tests {
+		if got := te.scoreImageURL(tt.url); got != tt.want {
+			t.Errorf("scoreImageURL(%q) = %d, want %d", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestExtractVideoMetadata(t *testing.T) {
+	te := &ThreadsExtractor{}
+
+	html := `<html><head><title> Clip by someone | Facebook</title></head><body><script>` +
+		`{"video_id":"1234567890","playable_duration_in_ms":15250,` +
+		`"browser_native_hd_url":"https:\/\/video.xx.fbcdn.net\/v\/hd.mp4?a=1&b=2",` +
+		`"browser_native_sd_url":"https:\/\/video.xx.fbcdn.net\/v\/sd.mp4",` +
+		`"playable_url":"https:\/\/video.xx.fbcdn.net\/v\/play.mp4"}` +
+		`</script></body></html>`
+
+	videoID, title, duration, videoUrls, metadata := te.extractVideoMetadata(context.Background(), html)
+
+	if videoID != "1234567890" {
+		t.Errorf("videoID = %q, want 1234567890", videoID)
+	}
+	if title != "Clip by someone" {
+		t.Errorf("title = %q, want %q", title, "Clip by someone")
+	}
+	if duration != 15 {
+		t.Errorf("duration = %d, want 15", duration)
+	}
+
+	wantUrls := map[string]string{
+		"browser_hd":   "https://video.xx.fbcdn.net/v/hd.mp4?a=1&b=2",
+		"browser_sd":   "https://video.xx.fbcdn.net/v/sd.mp4",
+		"playable_url": "https://video.xx.fbcdn.net/v/play.mp4",
+	}
+	if len(videoUrls) != len(wantUrls) {
+		t.Errorf("videoUrls = %v, want %v", videoUrls, wantUrls)
+	}
+	for k, want := range wantUrls {
+		if videoUrls[k] != want {
+			t.Errorf("videoUrls[%q] = %q, want %q", k, videoUrls[k], want)
+		}
+	}
+
+	if metadata["duration"] != "15 seconds" {
+		t.Errorf("metadata[duration] = %q, want %q", metadata["duration"], "15 seconds")
+	}
+}
+
+func TestExtractVideoMetadataEmpty(t *testing.T) {
+	te := &ThreadsExtractor{}
+
+	videoID, title, duration, videoUrls, metadata := te.extractVideoMetadata(context.Background(), "<html><body>nothing here</body></html>")
+	if videoID != "" || title != "" || duration != 0 || len(videoUrls) != 0 || len(metadata) != 0 {
+		t.Errorf("expected no metadata, got id=%q title=%q duration=%d urls=%v metadata=%v", videoID, title, duration, videoUrls, metadata)
+	}
+}
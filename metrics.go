@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsRegistry renders a fixed set of metrics in the Prometheus text exposition format.
+// It is deliberately tiny so the server has no dependency on a metrics client library.
+type metricsRegistry struct {
+	mu         sync.Mutex
+	collectors []metricCollector
+}
+
+// metricCollector is anything that can write itself in exposition format
+type metricCollector interface {
+	writeTo(w io.Writer)
+}
+
+func (r *metricsRegistry) register(c metricCollector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// render writes every registered metric
+func (r *metricsRegistry) render(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]metricCollector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.writeTo(w)
+	}
+}
+
+// counterVec is a monotonically increasing counter partitioned by labels
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(r *metricsRegistry, name, help string, labels ...string) *counterVec {
+	c := &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	r.register(c)
+	return c
+}
+
+// Add increases the counter for the given label values
+func (c *counterVec) Add(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Inc increases the counter for the given label values by one
+func (c *counterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current value for the given label values
+func (c *counterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[labelKey(labelValues)]
+}
+
+func (c *counterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+		return
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, key, "", ""), formatFloat(c.values[key]))
+	}
+}
+
+// gauge is a single value that can go up and down
+type gauge struct {
+	name string
+	help string
+
+	mu    sync.Mutex
+	value float64
+}
+
+func newGauge(r *metricsRegistry, name, help string) *gauge {
+	g := &gauge{name: name, help: help}
+	r.register(g)
+	return g
+}
+
+// Add changes the gauge by v
+func (g *gauge) Add(v float64) {
+	g.mu.Lock()
+	g.value += v
+	g.mu.Unlock()
+}
+
+// Inc increases the gauge by one
+func (g *gauge) Inc() { g.Add(1) }
+
+// Dec decreases the gauge by one
+func (g *gauge) Dec() { g.Add(-1) }
+
+// Value returns the current gauge value
+func (g *gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *gauge) writeTo(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.value))
+}
+
+// histogramVec tracks observations in cumulative buckets, partitioned by labels
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(r *metricsRegistry, name, help string, buckets []float64, labels ...string) *histogramVec {
+	h := &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.register(h)
+	return h
+}
+
+// Observe records a single value for the given label values
+func (h *histogramVec) Observe(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// ObserveDuration records the time elapsed since start in seconds
+func (h *histogramVec) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns how many observations were recorded for the given label values
+func (h *histogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[labelKey(labelValues)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *histogramVec) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, "", ""), s.count)
+	}
+}
+
+// labelKey joins label values into a map key; \xff never appears in valid label values we use
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// formatLabels renders {a="x",b="y"} with an optional extra label appended
+func formatLabels(names []string, key, extraName, extraValue string) string {
+	var parts []string
+	if len(names) > 0 {
+		values := strings.Split(key, "\xff")
+		for i, name := range names {
+			v := ""
+			if i < len(values) {
+				v = values[i]
+			}
+			parts = append(parts, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(v)))
+		}
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extraName, escapeLabelValue(extraValue)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// labelEscaper escapes the three characters the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes a label value for the exposition format
+func escapeLabelValue(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// latencyBuckets covers fast page loads up to slow browser extractions
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 8, 13, 20, 30, 60}
+
+// metrics holds every metric exported by the server
+var metrics = newServerMetrics()
+
+// serverMetrics groups the metrics exported on /metrics
+type serverMetrics struct {
+	registry *metricsRegistry
+
+	extractions        *counterVec
+	extractionDuration *histogramVec
+	navigationDuration *histogramVec
+	pagesInFlight      *gauge
+	browserRestarts    *counterVec
+	proxiedBytes       *counterVec
+	downloadResponses  *counterVec
+	proxyRequests      *counterVec
+	proxyEjections     *counterVec
+	blockedPages       *counterVec
+	extractionRetries  *counterVec
+}
+
+func newServerMetrics() *serverMetrics {
+	r := &metricsRegistry{}
+	return &serverMetrics{
+		registry: r,
+		extractions: newCounterVec(r, "threadsvid_extractions_total",
+			"Extractions by outcome and the strategy that produced the result.", "outcome", "strategy"),
+		extractionDuration: newHistogramVec(r, "threadsvid_extraction_duration_seconds",
+			"End-to-end extraction latency.", latencyBuckets, "outcome"),
+		navigationDuration: newHistogramVec(r, "threadsvid_navigation_duration_seconds",
+			"Time spent navigating to and loading the post page.", latencyBuckets),
+		pagesInFlight: newGauge(r, "threadsvid_pages_in_flight",
+			"Browser pages currently open for extraction."),
+		browserRestarts: newCounterVec(r, "threadsvid_browser_restarts_total",
+			"Times the browser was relaunched after becoming unusable."),
+		proxiedBytes: newCounterVec(r, "threadsvid_proxied_bytes_total",
+			"Bytes streamed to clients through /api/download."),
+		downloadResponses: newCounterVec(r, "threadsvid_download_responses_total",
+			"Download proxy responses by HTTP status code.", "code"),
+		proxyRequests: newCounterVec(r, "threadsvid_upstream_proxy_requests_total",
+			"Requests through each upstream proxy by outcome.", "proxy", "outcome"),
+		proxyEjections: newCounterVec(r, "threadsvid_upstream_proxy_ejections_total",
+			"Times an upstream proxy was taken out of rotation after repeated failures or a block.", "proxy"),
+		blockedPages: newCounterVec(r, "threadsvid_blocked_pages_total",
+			"Post pages Threads replaced with a login wall, error, rate limit or unavailable page.", "state"),
+		extractionRetries: newCounterVec(r, "threadsvid_extraction_retries_total",
+			"Extraction attempts retried after a transient error, by the kind of error.", "reason"),
+	}
+}
+
+// handleMetrics serves all metrics in Prometheus text format
+func handleMetrics(m *serverMetrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.registry.render(w)
+	}
+}
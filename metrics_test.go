@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files under testdata")
+
+func TestMetricsRenderGolden(t *testing.T) {
+	r := &metricsRegistry{}
+	requests := newCounterVec(r, "test_requests_total", "Requests by path.", "path", "code")
+	newCounterVec(r, "test_restarts_total", "A counter without labels.") // never incremented, renders 0
+	inFlight := newGauge(r, "test_in_flight", "Work in progress.")
+	latency := newHistogramVec(r, "test_latency_seconds", "Request latency.", []float64{0.1, 0.5, 1}, "outcome")
+
+	requests.Inc("/api/extract", "200")
+	requests.Add(2, "/api/extract", "400")
+	requests.Inc(`C:\path "quoted"`+"\nnext line", "500")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+
+	// One observation per bucket, one past the last
+	for _, v := range []float64{0.05, 0.3, 0.7, 2} {
+		latency.Observe(v, "success")
+	}
+	latency.Observe(0.5, "error") // exactly on a bucket boundary
+
+	var out strings.Builder
+	r.render(&out)
+
+	golden := filepath.Join("testdata", "metrics.golden")
+	if *updateGolden {
+		if err := os.WriteFile(golden, []byte(out.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if out.String() != string(want) {
+		t.Errorf("render output differs from %s:\n--- got\n%s\n--- want\n%s", golden, out.String(), want)
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	tests := map[string]string{
+		"plain":       "plain",
+		`back\slash`:  `back\\slash`,
+		`say "hi"`:    `say \"hi\"`,
+		"two\nlines":  `two\nlines`,
+		"unicode é ✓": "unicode é ✓",
+		"tab\tstays":  "tab\tstays",
+	}
+	for in, want := range tests {
+		if got := escapeLabelValue(in); got != want {
+			t.Errorf("escapeLabelValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
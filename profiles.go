@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// BrowserProfile is one realistic client an extraction can pose as. Everything
+// a page can read about its environment is set from the same profile, so the
+// values stay consistent with each other.
+type BrowserProfile struct {
+	Name           string  `yaml:"name" json:"name"`
+	UserAgent      string  `yaml:"userAgent" json:"userAgent"`
+	Platform       string  `yaml:"platform" json:"platform"` // navigator.platform, e.g. Win32, MacIntel, iPhone
+	ViewportWidth  int     `yaml:"viewportWidth" json:"viewportWidth"`
+	ViewportHeight int     `yaml:"viewportHeight" json:"viewportHeight"`
+	DeviceScale    float64 `yaml:"deviceScale" json:"deviceScale"`
+	Mobile         bool    `yaml:"mobile" json:"mobile"`                 // Touch and mobile emulation; posts open on m.threads.net
+	Locale         string  `yaml:"locale" json:"locale"`                 // e.g. en-US
+	Timezone       string  `yaml:"timezone" json:"timezone"`             // IANA name, e.g. America/New_York
+	AcceptLanguage string  `yaml:"acceptLanguage" json:"acceptLanguage"` // e.g. "en-US,en;q=0.9"
+}
+
+// ProfilesConfig controls how extractions pick a browser profile
+type ProfilesConfig struct {
+	Rotation string           `yaml:"rotation" json:"rotation"` // "request" (new profile per extraction) or "session" (one per browser launch)
+	List     []BrowserProfile `yaml:"list" json:"list"`         // Built-in desktop and mobile profiles when empty
+}
+
+// defaultProfiles is the pool used when browser.profiles.list is empty
+var defaultProfiles = []BrowserProfile{
+	{
+		Name:           "chrome-windows",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+		Platform:       "Win32",
+		ViewportWidth:  1920,
+		ViewportHeight: 1080,
+		DeviceScale:    1,
+		Locale:         "en-US",
+		Timezone:       "America/New_York",
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+	{
+		Name:           "edge-windows",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36 Edg/131.0.0.0",
+		Platform:       "Win32",
+		ViewportWidth:  1536,
+		ViewportHeight: 864,
+		DeviceScale:    1.25,
+		Locale:         "en-GB",
+		Timezone:       "Europe/London",
+		AcceptLanguage: "en-GB,en;q=0.9",
+	},
+	{
+		Name:           "chrome-mac",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+		Platform:       "MacIntel",
+		ViewportWidth:  1440,
+		ViewportHeight: 900,
+		DeviceScale:    2,
+		Locale:         "en-US",
+		Timezone:       "America/Los_Angeles",
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+	{
+		Name:           "safari-mac",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Safari/605.1.15",
+		Platform:       "MacIntel",
+		ViewportWidth:  1512,
+		ViewportHeight: 982,
+		DeviceScale:    2,
+		Locale:         "en-US",
+		Timezone:       "America/Chicago",
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+	{
+		Name:           "iphone-safari",
+		UserAgent:      "Mozilla/5.0 (iPhone; CPU iPhone OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Mobile/15E148 Safari/604.1",
+		Platform:       "iPhone",
+		ViewportWidth:  390,
+		ViewportHeight: 844,
+		DeviceScale:    3,
+		Mobile:         true,
+		Locale:         "en-US",
+		Timezone:       "America/New_York",
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+	{
+		Name:           "android-chrome",
+		UserAgent:      "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Mobile Safari/537.36",
+		Platform:       "Linux armv81",
+		ViewportWidth:  412,
+		ViewportHeight: 915,
+		DeviceScale:    2.625,
+		Mobile:         true,
+		Locale:         "en-US",
+		Timezone:       "America/Denver",
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+}
+
+// Validate checks a profile has what the page setup needs
+func (p BrowserProfile) Validate() error {
+	if p.UserAgent == "" {
+		return fmt.Errorf("userAgent must not be empty")
+	}
+	if p.ViewportWidth <= 0 || p.ViewportHeight <= 0 {
+		return fmt.Errorf("viewport dimensions must be positive")
+	}
+	if p.DeviceScale <= 0 {
+		return fmt.Errorf("deviceScale must be positive")
+	}
+	return nil
+}
+
+// postURL is the URL the profile opens for a post. Mobile profiles get the
+// m.threads.net layout; URLs already pointed elsewhere (tests) are left alone.
+func (p BrowserProfile) postURL(target string) string {
+	if !p.Mobile {
+		return target
+	}
+	return strings.Replace(target, "https://www.threads.net/", "https://m.threads.net/", 1)
+}
+
+// apply sets up page to look like the profile. It must run before navigation.
+func (p BrowserProfile) apply(page *rod.Page) error {
+	if err := page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
+		UserAgent:      p.UserAgent,
+		AcceptLanguage: p.AcceptLanguage,
+		Platform:       p.Platform,
+	}); err != nil {
+		return fmt.Errorf("user agent: %v", err)
+	}
+	if err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
+		Width:             p.ViewportWidth,
+		Height:            p.ViewportHeight,
+		DeviceScaleFactor: p.DeviceScale,
+		Mobile:            p.Mobile,
+	}); err != nil {
+		return fmt.Errorf("viewport: %v", err)
+	}
+	if p.Mobile {
+		touchPoints := 5
+		if err := (proto.EmulationSetTouchEmulationEnabled{Enabled: true, MaxTouchPoints: &touchPoints}).Call(page); err != nil {
+			return fmt.Errorf("touch emulation: %v", err)
+		}
+	}
+	if p.Timezone != "" {
+		if err := (proto.EmulationSetTimezoneOverride{TimezoneID: p.Timezone}).Call(page); err != nil {
+			return fmt.Errorf("timezone: %v", err)
+		}
+	}
+	if p.Locale != "" {
+		// CDP wants the ICU form, en_US rather than en-US
+		if err := (proto.EmulationSetLocaleOverride{Locale: strings.ReplaceAll(p.Locale, "-", "_")}).Call(page); err != nil {
+			return fmt.Errorf("locale: %v", err)
+		}
+	}
+	return nil
+}
+
+// profileRotator hands out a profile per extraction
+type profileRotator struct {
+	mu       sync.Mutex
+	profiles []BrowserProfile
+	session  bool // one profile per browser launch instead of per extraction
+	current  BrowserProfile
+}
+
+// newProfileRotator builds the pool from the browser config. A configured
+// userAgent pins a single profile made from the legacy viewport settings.
+func newProfileRotator(cfg BrowserConfig) *profileRotator {
+	profiles := cfg.Profiles.List
+	switch {
+	case cfg.UserAgent != "":
+		profiles = []BrowserProfile{{
+			Name:           "configured",
+			UserAgent:      cfg.UserAgent,
+			ViewportWidth:  cfg.ViewportWidth,
+			ViewportHeight: cfg.ViewportHeight,
+			DeviceScale:    cfg.DeviceScale,
+		}}
+	case len(profiles) == 0:
+		profiles = defaultProfiles
+	}
+
+	r := &profileRotator{profiles: profiles, session: cfg.Profiles.Rotation == "session"}
+	r.newSession()
+	return r
+}
+
+// newSession picks the profile used until the next browser launch in session mode
+func (r *profileRotator) newSession() {
+	r.mu.Lock()
+	r.current = r.profiles[rand.Intn(len(r.profiles))]
+	r.mu.Unlock()
+}
+
+// pick returns the profile for the next extraction
+func (r *profileRotator) pick() BrowserProfile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session {
+		return r.current
+	}
+	return r.profiles[rand.Intn(len(r.profiles))]
+}
+
+// pickOther returns a profile other than the one named avoid, for retrying an
+// extraction as a different client. Session rotation keeps the session's
+// profile.
+func (r *profileRotator) pickOther(avoid string) BrowserProfile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session {
+		return r.current
+	}
+	var others []BrowserProfile
+	for _, p := range r.profiles {
+		if p.Name != avoid {
+			others = append(others, p)
+		}
+	}
+	if len(others) == 0 {
+		return r.profiles[rand.Intn(len(r.profiles))]
+	}
+	return others[rand.Intn(len(others))]
+}
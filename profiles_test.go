@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfileRotatorPinnedUserAgent(t *testing.T) {
+	cfg := DefaultConfig().Browser
+	cfg.UserAgent = "TestAgent/1.0"
+	r := newProfileRotator(cfg)
+	for i := 0; i < 10; i++ {
+		p := r.pick()
+		if p.UserAgent != "TestAgent/1.0" || p.ViewportWidth != cfg.ViewportWidth || p.Mobile {
+			t.Fatalf("pick() = %+v, want the configured profile", p)
+		}
+	}
+}
+
+func TestProfileRotatorSession(t *testing.T) {
+	cfg := DefaultConfig().Browser
+	cfg.Profiles.Rotation = "session"
+	r := newProfileRotator(cfg)
+	first := r.pick()
+	for i := 0; i < 10; i++ {
+		if p := r.pick(); p.Name != first.Name {
+			t.Fatalf("session rotation changed profile from %s to %s", first.Name, p.Name)
+		}
+	}
+}
+
+func TestProfileRotatorUsesList(t *testing.T) {
+	cfg := DefaultConfig().Browser
+	cfg.Profiles.List = []BrowserProfile{{Name: "only", UserAgent: "Only/1.0", ViewportWidth: 800, ViewportHeight: 600, DeviceScale: 1}}
+	if p := newProfileRotator(cfg).pick(); p.Name != "only" {
+		t.Errorf("pick() = %s, want only", p.Name)
+	}
+}
+
+func TestProfilePostURL(t *testing.T) {
+	desktop := BrowserProfile{}
+	mobile := BrowserProfile{Mobile: true}
+	post := "https://www.threads.net/@user/post/ABC123"
+
+	if got := desktop.postURL(post); got != post {
+		t.Errorf("desktop postURL = %s", got)
+	}
+	if got := mobile.postURL(post); got != "https://m.threads.net/@user/post/ABC123" {
+		t.Errorf("mobile postURL = %s", got)
+	}
+	if got := mobile.postURL("http://127.0.0.1:8080/@user/post/ABC123"); got != "http://127.0.0.1:8080/@user/post/ABC123" {
+		t.Errorf("rewritten URL changed: %s", got)
+	}
+}
+
+func TestProfilesConfigValidation(t *testing.T) {
+	for _, p := range defaultProfiles {
+		if err := p.Validate(); err != nil {
+			t.Errorf("default profile %s: %v", p.Name, err)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Browser.Profiles.Rotation = "hourly"
+	cfg.Browser.Profiles.List = []BrowserProfile{{Name: "broken", ViewportWidth: 800, ViewportHeight: 600, DeviceScale: 1}}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "hourly") || !strings.Contains(err.Error(), "broken: userAgent") {
+		t.Errorf("expected rotation and profile problems, got %v", err)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ProxyConfig is the pool of upstream proxies extraction pages, post page
+// fetches and media downloads go through
+type ProxyConfig struct {
+	URLs                []string `yaml:"urls" json:"urls"`                               // http://, https:// or socks5:// URLs, with user:pass@ for auth
+	MaxFailures         int      `yaml:"maxFailures" json:"maxFailures"`                 // Consecutive failures before a proxy is ejected
+	EjectFor            Duration `yaml:"ejectFor" json:"ejectFor"`                       // How long an ejected proxy sits out
+	StickyFor           Duration `yaml:"stickyFor" json:"stickyFor"`                     // How long a post keeps its proxy
+	HealthCheckURL      string   `yaml:"healthCheckUrl" json:"healthCheckUrl"`           // Fetched through ejected proxies before they return
+	HealthCheckInterval Duration `yaml:"healthCheckInterval" json:"healthCheckInterval"` // 0 lets ejected proxies return unchecked
+}
+
+// proxySchemes are the proxy URL schemes both Chromium and net/http understand
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true}
+
+// validateProxyURL checks raw is a proxy both the browser and the HTTP clients can use
+func validateProxyURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("not a valid URL")
+	}
+	if !proxySchemes[u.Scheme] {
+		return fmt.Errorf("scheme must be http, https or socks5")
+	}
+	// Chromium only answers auth challenges from HTTP proxies
+	if u.Scheme == "socks5" && u.User != nil {
+		return fmt.Errorf("socks5 proxies with credentials are not supported by the browser")
+	}
+	return nil
+}
+
+// upstreamProxy is one proxy of the pool with its health
+type upstreamProxy struct {
+	url   *url.URL
+	label string // host:port, safe to log since it has no credentials
+
+	failures     int
+	ejectedUntil time.Time
+}
+
+// server is the proxy as Chromium's proxyServer setting, without credentials
+func (p *upstreamProxy) server() string {
+	return p.url.Scheme + "://" + p.url.Host
+}
+
+// credentials returns the user and password for proxy auth challenges
+func (p *upstreamProxy) credentials() (user, pass string, ok bool) {
+	if p.url.User == nil {
+		return "", "", false
+	}
+	pass, _ = p.url.User.Password()
+	return p.url.User.Username(), pass, true
+}
+
+// stickyProxy is the proxy a post was last served through
+type stickyProxy struct {
+	proxy *upstreamProxy
+	until time.Time
+}
+
+// maxStickyEntries bounds the sticky map; expired entries are swept past it
+const maxStickyEntries = 1024
+
+// proxyPool hands out healthy proxies round robin. A post keeps its proxy for
+// stickyFor so retries and follow-up downloads look like the same client.
+// A nil pool means no proxies are configured and every caller goes direct.
+type proxyPool struct {
+	cfg     ProxyConfig
+	now     func() time.Time
+	checker *http.Client
+
+	mu      sync.Mutex
+	proxies []*upstreamProxy
+	next    int
+	sticky  map[string]stickyProxy
+	stop    chan struct{}
+	stopped sync.Once
+}
+
+// newProxyPool builds the pool from the proxies config, falling back to the
+// single browser.proxy. It returns nil when neither is set.
+func newProxyPool(cfg *Config) *proxyPool {
+	urls := cfg.Proxies.URLs
+	if len(urls) == 0 && cfg.Browser.Proxy != "" {
+		urls = []string{cfg.Browser.Proxy}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	p := &proxyPool{
+		cfg:    cfg.Proxies,
+		now:    time.Now,
+		sticky: make(map[string]stickyProxy),
+		stop:   make(chan struct{}),
+	}
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			// Validate has already reported it
+			continue
+		}
+		p.proxies = append(p.proxies, &upstreamProxy{url: u, label: u.Host})
+	}
+	if len(p.proxies) == 0 {
+		return nil
+	}
+
+	if cfg.Proxies.HealthCheckURL != "" && cfg.Proxies.HealthCheckInterval > 0 {
+		p.checker = &http.Client{
+			Timeout:   cfg.Extraction.HTTPTimeout.Std(),
+			Transport: proxiedTransport(),
+		}
+		go p.healthLoop()
+	}
+	return p
+}
+
+// pick returns the proxy for key (a post or media URL), or nil when the pool
+// is empty. When every proxy is ejected the one due back first is used rather
+// than failing outright.
+func (p *proxyPool) pick(key string) *upstreamProxy {
+	return p.pickExcept(key, nil)
+}
+
+// pickExcept is pick steering clear of avoid, the proxy a failed attempt
+// used. avoid is only handed out again when no other proxy is available; the
+// post sticks to whichever proxy is returned.
+func (p *proxyPool) pickExcept(key string, avoid *upstreamProxy) *upstreamProxy {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	if s, ok := p.sticky[key]; ok && now.Before(s.until) && s.proxy != avoid && p.available(s.proxy, now) {
+		return s.proxy
+	}
+
+	var chosen *upstreamProxy
+	for i := 0; i < len(p.proxies); i++ {
+		candidate := p.proxies[(p.next+i)%len(p.proxies)]
+		if candidate != avoid && p.available(candidate, now) {
+			chosen = candidate
+			p.next = (p.next + i + 1) % len(p.proxies)
+			break
+		}
+	}
+	if chosen == nil && avoid != nil && p.available(avoid, now) {
+		chosen = avoid
+	}
+	if chosen == nil {
+		for _, candidate := range p.proxies {
+			if chosen == nil || candidate.ejectedUntil.Before(chosen.ejectedUntil) {
+				chosen = candidate
+			}
+		}
+	}
+
+	if len(p.sticky) >= maxStickyEntries {
+		for k, s := range p.sticky {
+			if !now.Before(s.until) {
+				delete(p.sticky, k)
+			}
+		}
+	}
+	p.sticky[key] = stickyProxy{proxy: chosen, until: now.Add(p.cfg.StickyFor.Std())}
+	return chosen
+}
+
+// available reports whether proxy may be handed out. Without health checks an
+// ejected proxy comes back on its own once its ejection is over.
+func (p *proxyPool) available(proxy *upstreamProxy, now time.Time) bool {
+	if proxy.ejectedUntil.IsZero() {
+		return true
+	}
+	if p.checker == nil && !now.Before(proxy.ejectedUntil) {
+		proxy.ejectedUntil = time.Time{}
+		proxy.failures = 0
+		return true
+	}
+	return false
+}
+
+// report records the outcome of a request made through proxy. Failures past
+// maxFailures in a row eject the proxy and drop the posts stuck to it.
+func (p *proxyPool) report(proxy *upstreamProxy, err error) {
+	if p == nil || proxy == nil {
+		return
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	metrics.proxyRequests.Inc(proxy.label, outcome)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		proxy.failures = 0
+		return
+	}
+	proxy.failures++
+	if proxy.failures < p.cfg.MaxFailures || !proxy.ejectedUntil.IsZero() {
+		return
+	}
+	p.eject(proxy, p.cfg.EjectFor.Std())
+	slog.Warn("proxy ejected", "proxy", proxy.label, "failures", proxy.failures, "error", err, "eject_for", p.cfg.EjectFor.Std().String())
+}
+
+// penalize ejects proxy for d because Threads blocked a request made through
+// it, extending an ejection already in progress
+func (p *proxyPool) penalize(proxy *upstreamProxy, d time.Duration) {
+	if p == nil || proxy == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until := p.now().Add(d); until.After(proxy.ejectedUntil) {
+		p.eject(proxy, d)
+	}
+}
+
+// eject takes proxy out of rotation for d; p.mu must be held
+func (p *proxyPool) eject(proxy *upstreamProxy, d time.Duration) {
+	proxy.ejectedUntil = p.now().Add(d)
+	metrics.proxyEjections.Inc(proxy.label)
+	for k, s := range p.sticky {
+		if s.proxy == proxy {
+			delete(p.sticky, k)
+		}
+	}
+}
+
+// healthy returns how many proxies are in rotation and the pool size
+func (p *proxyPool) healthy() (healthy, total int) {
+	if p == nil {
+		return 0, 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for _, proxy := range p.proxies {
+		if p.available(proxy, now) {
+			healthy++
+		}
+	}
+	return healthy, len(p.proxies)
+}
+
+// healthLoop probes ejected proxies whose ejection is over, returning the
+// ones that work and keeping the rest out for another ejectFor
+func (p *proxyPool) healthLoop() {
+	ticker := time.NewTicker(p.cfg.HealthCheckInterval.Std())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+
+		p.mu.Lock()
+		var due []*upstreamProxy
+		now := p.now()
+		for _, proxy := range p.proxies {
+			if !proxy.ejectedUntil.IsZero() && !now.Before(proxy.ejectedUntil) {
+				due = append(due, proxy)
+			}
+		}
+		p.mu.Unlock()
+
+		for _, proxy := range due {
+			err := p.check(proxy)
+			p.mu.Lock()
+			if err == nil {
+				proxy.ejectedUntil = time.Time{}
+				proxy.failures = 0
+			} else {
+				proxy.ejectedUntil = p.now().Add(p.cfg.EjectFor.Std())
+			}
+			p.mu.Unlock()
+			if err == nil {
+				slog.Info("proxy back in rotation", "proxy", proxy.label)
+			} else {
+				slog.Warn("proxy health check failed", "proxy", proxy.label, "error", err)
+			}
+		}
+	}
+}
+
+// check fetches the health check URL through proxy
+func (p *proxyPool) check(proxy *upstreamProxy) error {
+	req, err := http.NewRequestWithContext(withProxy(context.Background(), proxy), "GET", p.cfg.HealthCheckURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.checker.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusProxyAuthRequired || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close stops the health checks; it is safe to call on a nil pool
+func (p *proxyPool) Close() {
+	if p == nil {
+		return
+	}
+	p.stopped.Do(func() { close(p.stop) })
+}
+
+// proxyContextKey carries the proxy chosen for an outgoing HTTP request
+type proxyContextKey struct{}
+
+// withProxy makes HTTP clients built with proxiedTransport use proxy for
+// requests made with ctx; a nil proxy means a direct connection
+func withProxy(ctx context.Context, proxy *upstreamProxy) context.Context {
+	return context.WithValue(ctx, proxyContextKey{}, proxy)
+}
+
+// proxyFrom returns the proxy withProxy stored in ctx, or nil
+func proxyFrom(ctx context.Context) *upstreamProxy {
+	proxy, _ := ctx.Value(proxyContextKey{}).(*upstreamProxy)
+	return proxy
+}
+
+// proxiedTransport is an HTTP transport that sends each request through the
+// proxy in its context
+func proxiedTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if proxy := proxyFrom(req.Context()); proxy != nil {
+			return proxy.url, nil
+		}
+		return nil, nil
+	}
+	return transport
+}
+
+// proxyFailure returns the error an HTTP outcome counts against its proxy
+// for, or nil: the connection failed, the proxy refused our credentials or the
+// site rate limited us. Callers skip reporting when their context is done.
+func proxyFailure(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusProxyAuthRequired || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
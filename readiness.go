@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Signals that end the wait for a page, as reported by readiness.wait
+const (
+	readyVideo       = "video"        // a <video> has a playable source
+	readyPostData    = "post_data"    // the post JSON is in the parsed document
+	readyUnavailable = "unavailable"  // deleted post or login wall, nothing more will load
+	readyNetworkIdle = "network_idle" // no requests in flight for extraction.networkIdle
+	readyTimeout     = "timeout"      // none of the above before the navigation timeout
+)
+
+// readyPollInterval is how often the page is checked for the DOM signals
+const readyPollInterval = 100 * time.Millisecond
+
+// readinessJS returns the first DOM signal the page shows, or an empty string
+const readinessJS = `() => {
+	const playable = s => /^https?:/.test(s || '');
+	if (Array.from(document.querySelectorAll('video')).some(v =>
+		playable(v.currentSrc) || playable(v.src) || Array.from(v.querySelectorAll('source')).some(s => playable(s.src)))) {
+		return 'video';
+	}
+	const postData = Array.from(document.querySelectorAll('script[type="application/json"]'))
+		.some(s => /"(video_versions|image_versions2|carousel_media)"/.test(s.textContent));
+	if (postData && document.readyState !== 'loading') {
+		return 'post_data';
+	}
+	// Error wording only counts on a page without a post, not in a caption
+	const hasPost = postData || !!document.querySelector('article, video');
+	const text = document.body && !hasPost ? document.body.innerText : '';
+	if (document.querySelector('#loginForm, form[action*="/accounts/login"]') ||
+		/Sorry, this page isn.t available|Something went wrong/i.test(text)) {
+		return 'unavailable';
+	}
+	return '';
+}`
+
+// readiness watches a page from before navigation until it is worth
+// extracting from, replacing fixed sleeps with whichever signal comes first
+type readiness struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	idle   func()
+}
+
+// watchReadiness must be called before navigating, so the network idle
+// detector sees every request of the page. ctx bounds the whole wait.
+func (te *ThreadsExtractor) watchReadiness(ctx context.Context, page *rod.Page) *readiness {
+	ctx, cancel := context.WithCancel(ctx)
+	// Media streams and long-lived connections never go idle, ignore them
+	idle := page.Context(ctx).WaitRequestIdle(te.cfg.Extraction.NetworkIdle.Std(), nil, nil, []proto.NetworkResourceType{
+		proto.NetworkResourceTypeWebSocket,
+		proto.NetworkResourceTypeEventSource,
+		proto.NetworkResourceTypeMedia,
+	})
+	return &readiness{ctx: ctx, cancel: cancel, idle: idle}
+}
+
+// wait blocks until the page shows a readiness signal and returns it. It
+// returns readyTimeout when the watch context expires, so the caller can still
+// try extracting from whatever has loaded.
+func (r *readiness) wait(page *rod.Page) string {
+	defer r.cancel()
+
+	signals := make(chan string, 2)
+	go func() {
+		r.idle()
+		if r.ctx.Err() == nil {
+			signals <- readyNetworkIdle
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(readyPollInterval)
+		defer ticker.Stop()
+		for {
+			// Evaluation fails while the document is being replaced, just poll again
+			if res, err := page.Context(r.ctx).Eval(readinessJS); err == nil && res.Value.Str() != "" {
+				signals <- res.Value.Str()
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	select {
+	case signal := <-signals:
+		return signal
+	case <-r.ctx.Done():
+		return readyTimeout
+	}
+}
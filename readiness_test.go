@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadinessSignals(t *testing.T) {
+	pages := map[string]string{
+		"/video": `<html><body><video src="https://scontent.cdninstagram.com/v/clip.mp4"></video></body></html>`,
+		"/json":  `<html><body><script type="application/json">{"post":{"video_versions":[]}}</script></body></html>`,
+		"/gone":  `<html><body><span>Sorry, this page isn't available</span></body></html>`,
+		"/idle":  `<html><body><div>nothing to see</div></body></html>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	te := newTestExtractor(t, srv)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/video", readyVideo},
+		{"/json", readyPostData},
+		{"/gone", readyUnavailable},
+		{"/idle", readyNetworkIdle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			page, _, release, err := te.acquirePage(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			ready := te.watchReadiness(ctx, page)
+			if err := page.Context(ctx).Navigate(srv.URL + tt.path); err != nil {
+				ready.cancel()
+				t.Fatal(err)
+			}
+			start := time.Now()
+			if got := ready.wait(page); got != tt.want {
+				t.Errorf("signal = %q, want %q", got, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("readiness took %v", elapsed)
+			}
+		})
+	}
+}
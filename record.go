@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// fixtureExpectation is the contents of a fixture's expected.json
+type fixtureExpectation struct {
+	URL      string           `json:"url"`
+	Note     string           `json:"note,omitempty"`
+	Response *ExtractResponse `json:"response,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// HAR 1.2 subset written by the recorder, see http://www.softwareishard.com/blog/har-12-spec/
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	ResourceType    string      `json:"_resourceType,omitempty"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	QueryString []harHeader `json:"queryString"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	Content     harContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Body decodes the recorded response body
+func (c harContent) Body() ([]byte, error) {
+	if c.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(c.Text)
+	}
+	return []byte(c.Text), nil
+}
+
+// loadHAR reads a HAR file written by the recorder
+func loadHAR(path string) (*harFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return &har, nil
+}
+
+// pageRecorder captures every network exchange of a page plus its final HTML
+type pageRecorder struct {
+	mu      sync.Mutex
+	entries map[proto.NetworkRequestID]*recordedExchange
+	order   []proto.NetworkRequestID
+	html    string
+	htmlErr error
+}
+
+// recordedExchange is one request as seen through the Network domain events
+type recordedExchange struct {
+	entry      harEntry
+	started    proto.MonotonicTime
+	finished   bool
+	redirected bool // a hop answered with a redirect, it has no body
+}
+
+func newPageRecorder() *pageRecorder {
+	return &pageRecorder{entries: make(map[proto.NetworkRequestID]*recordedExchange)}
+}
+
+// observe matches ThreadsExtractor.observePage: it starts listening to network
+// events and, once extraction is done, fetches response bodies and the HTML.
+// Every retry attempt opens a new page, so whatever an earlier attempt recorded
+// is dropped and the fixture holds the last navigation only.
+func (pr *pageRecorder) observe(ctx context.Context, page *rod.Page) func() {
+	pr.reset()
+
+	listenCtx, stop := context.WithCancel(ctx)
+	wait := page.Context(listenCtx).EachEvent(
+		pr.onRequest,
+		pr.onResponse,
+		pr.onFinished,
+		pr.onFailed,
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wait()
+	}()
+
+	return func() {
+		pr.capture(ctx, page)
+		stop()
+		<-done
+	}
+}
+
+// reset forgets everything recorded so far
+func (pr *pageRecorder) reset() {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.entries = make(map[proto.NetworkRequestID]*recordedExchange)
+	pr.order = nil
+	pr.html, pr.htmlErr = "", nil
+}
+
+func (pr *pageRecorder) onRequest(e *proto.NetworkRequestWillBeSent) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	// Redirects reuse the request ID; keep the hop that was redirected as its own entry
+	if prev, ok := pr.entries[e.RequestID]; ok && e.RedirectResponse != nil {
+		prev.entry.Response = harResponseFrom(e.RedirectResponse)
+		prev.entry.Response.RedirectURL = e.Request.URL
+		prev.finished = true
+		prev.redirected = true
+		redirectID := proto.NetworkRequestID(fmt.Sprintf("%s.redirect%d", e.RequestID, len(pr.order)))
+		pr.entries[redirectID] = prev
+		for i, id := range pr.order {
+			if id == e.RequestID {
+				pr.order[i] = redirectID
+			}
+		}
+	}
+
+	pr.entries[e.RequestID] = &recordedExchange{
+		started: e.Timestamp,
+		entry: harEntry{
+			StartedDateTime: e.WallTime.Time().UTC().Format(time.RFC3339Nano),
+			Request: harRequest{
+				Method:      e.Request.Method,
+				URL:         e.Request.URL,
+				HTTPVersion: "HTTP/1.1",
+				Headers:     harHeaders(e.Request.Headers),
+				QueryString: harQuery(e.Request.URL),
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+			ResourceType: strings.ToLower(string(e.Type)),
+		},
+	}
+	pr.order = append(pr.order, e.RequestID)
+}
+
+func (pr *pageRecorder) onResponse(e *proto.NetworkResponseReceived) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if ex, ok := pr.entries[e.RequestID]; ok {
+		ex.entry.Response = harResponseFrom(e.Response)
+		ex.entry.Request.HTTPVersion = ex.entry.Response.HTTPVersion
+	}
+}
+
+func (pr *pageRecorder) onFinished(e *proto.NetworkLoadingFinished) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if ex, ok := pr.entries[e.RequestID]; ok {
+		ex.finished = true
+		ex.entry.Time = float64((e.Timestamp - ex.started).Duration().Microseconds()) / 1000
+		ex.entry.Response.BodySize = int(e.EncodedDataLength)
+	}
+}
+
+func (pr *pageRecorder) onFailed(e *proto.NetworkLoadingFailed) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if ex, ok := pr.entries[e.RequestID]; ok {
+		ex.entry.Time = float64((e.Timestamp - ex.started).Duration().Microseconds()) / 1000
+		ex.entry.Error = e.ErrorText
+	}
+}
+
+// capture saves the page HTML and pulls the bodies of finished responses while
+// the page is still open; Chrome discards them once it closes. The lock is not
+// held across CDP calls so network events keep flowing meanwhile.
+func (pr *pageRecorder) capture(ctx context.Context, page *rod.Page) {
+	p := page.Context(ctx)
+	html, htmlErr := p.HTML()
+
+	pr.mu.Lock()
+	pr.html, pr.htmlErr = html, htmlErr
+	var pending []proto.NetworkRequestID
+	for id, ex := range pr.entries {
+		if ex.finished && !ex.redirected && ex.entry.Response.Status != 0 {
+			pending = append(pending, id)
+		}
+	}
+	pr.mu.Unlock()
+
+	for _, id := range pending {
+		body, err := proto.NetworkGetResponseBody{RequestID: id}.Call(p)
+		if err != nil {
+			slog.Debug("response body unavailable", "request_id", id, "error", err)
+			continue
+		}
+
+		content := harContent{Text: body.Body, Size: len(body.Body)}
+		if body.Base64Encoded {
+			content.Encoding = "base64"
+			if raw, err := base64.StdEncoding.DecodeString(body.Body); err == nil {
+				content.Size = len(raw)
+			}
+		}
+
+		pr.mu.Lock()
+		c := &pr.entries[id].entry.Response.Content
+		c.Text, c.Encoding, c.Size = content.Text, content.Encoding, content.Size
+		pr.mu.Unlock()
+	}
+}
+
+// HAR returns the recorded exchanges in request order
+func (pr *pageRecorder) HAR() *harFile {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	har := &harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "threadsvid record", Version: "1"},
+		Entries: make([]harEntry, 0, len(pr.order)),
+	}}
+	for _, id := range pr.order {
+		har.Log.Entries = append(har.Log.Entries, pr.entries[id].entry)
+	}
+	return har
+}
+
+func harResponseFrom(r *proto.NetworkResponse) harResponse {
+	version := strings.ToUpper(r.Protocol)
+	switch version {
+	case "", "DATA", "BLOB":
+		version = "HTTP/1.1"
+	case "H2":
+		version = "HTTP/2"
+	case "H3":
+		version = "HTTP/3"
+	}
+	return harResponse{
+		Status:      r.Status,
+		StatusText:  r.StatusText,
+		HTTPVersion: version,
+		Headers:     harHeaders(r.Headers),
+		Content:     harContent{MimeType: r.MIMEType},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+}
+
+// harHeaders converts CDP headers into a list sorted by name for stable output
+func harHeaders(h proto.NetworkHeaders) []harHeader {
+	headers := make([]harHeader, 0, len(h))
+	for name, value := range h {
+		headers = append(headers, harHeader{Name: name, Value: value.Str()})
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+func harQuery(rawURL string) []harHeader {
+	query := []harHeader{}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return query
+	}
+	for name, values := range u.Query() {
+		for _, v := range values {
+			query = append(query, harHeader{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(query, func(i, j int) bool { return query[i].Name < query[j].Name })
+	return query
+}
+
+// writeJSONFile writes v as indented JSON
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// runRecord implements `threadsvid record`: it loads a live post with the same
+// browser settings the server uses and saves it as an extraction fixture
+func runRecord(args []string) int {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	cf := registerConfigFlags(fs)
+	dir := fs.String("dir", filepath.Join("testdata", "fixtures"), "directory the fixture is written under")
+	name := fs.String("name", "", "fixture name (default: the post ID)")
+	force := fs.Bool("force", false, "overwrite an existing fixture")
+	timeout := fs.Duration("timeout", 60*time.Second, "overall time limit for the extraction")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s record [flags] <threads post URL>\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	cfg, err := commandConfig(fs, cf, args)
+	if errors.Is(err, errConfigPrinted) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	postURL := fs.Arg(0)
+
+	te := &ThreadsExtractor{cfg: cfg}
+	normalized, err := te.normalizeURL(postURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "record: %v\n", err)
+		return 2
+	}
+
+	fixtureName := *name
+	if fixtureName == "" {
+		fixtureName = path.Base(strings.TrimSuffix(normalized, "/"))
+	}
+	fixtureDir := filepath.Join(*dir, fixtureName)
+	if _, err := os.Stat(fixtureDir); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "record: %s already exists, use -force to overwrite\n", fixtureDir)
+		return 1
+	}
+
+	// A fixture is a capture of the post page in the browser, so never stop at
+	// the HTTP tier or navigate away to the embed page. Replay loads the desktop
+	// layout, so record it with a desktop profile unless one is pinned.
+	cfg.Extraction.HTTPFirst = false
+	cfg.Extraction.EmbedFallback = false
+	if cfg.Browser.UserAgent == "" {
+		cfg.Browser.Profiles.List = defaultProfiles[:1]
+	}
+	extractor, err := NewThreadsExtractor(cfg)
+	if err != nil {
+		slog.Error("failed to initialize Threads extractor", "error", err)
+		return 1
+	}
+	defer extractor.Close()
+
+	recorder := newPageRecorder()
+	extractor.observePage = recorder.observe
+
+	ctx, stop := signalContext()
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	slog.Info("recording fixture", "url", normalized, "dir", fixtureDir)
+	result, extractErr := extractor.extractMediaURL(ctx, postURL)
+
+	if recorder.htmlErr != nil || recorder.html == "" {
+		slog.Error("failed to capture page HTML", "error", recorder.htmlErr, "extract_error", extractErr)
+		return 1
+	}
+
+	expected := fixtureExpectation{
+		URL:  normalized,
+		Note: fmt.Sprintf("recorded from the live page on %s", time.Now().UTC().Format("2006-01-02")),
+	}
+	if extractErr != nil {
+		expected.Error = extractErr.Error()
+	} else {
+		result.Timings = nil
+		expected.Response = result
+	}
+
+	if err := os.MkdirAll(fixtureDir, 0o755); err != nil {
+		slog.Error("failed to create fixture directory", "error", err)
+		return 1
+	}
+	if err := os.WriteFile(filepath.Join(fixtureDir, "page.html"), []byte(recorder.html), 0o644); err != nil {
+		slog.Error("failed to write page.html", "error", err)
+		return 1
+	}
+	har := recorder.HAR()
+	if err := writeJSONFile(filepath.Join(fixtureDir, "network.har"), har); err != nil {
+		slog.Error("failed to write network.har", "error", err)
+		return 1
+	}
+	if err := writeJSONFile(filepath.Join(fixtureDir, "expected.json"), expected); err != nil {
+		slog.Error("failed to write expected.json", "error", err)
+		return 1
+	}
+
+	slog.Info("fixture recorded",
+		"dir", fixtureDir,
+		"responses", len(har.Log.Entries),
+		"success", extractErr == nil,
+	)
+	return 0
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/cdp"
+)
+
+// RetryConfig controls how extractions are retried after transient errors
+type RetryConfig struct {
+	MaxAttempts    int      `yaml:"maxAttempts" json:"maxAttempts"`       // Attempts per extraction, 1 disables retries
+	BaseDelay      Duration `yaml:"baseDelay" json:"baseDelay"`           // Wait before the first retry, doubling per retry
+	MaxDelay       Duration `yaml:"maxDelay" json:"maxDelay"`             // Cap for the wait between attempts
+	MaxTotal       Duration `yaml:"maxTotal" json:"maxTotal"`             // No retry starts later than this after the extraction began
+	MinAttemptTime Duration `yaml:"minAttemptTime" json:"minAttemptTime"` // A retry needs this much time left before the deadline
+	SwitchProxy    bool     `yaml:"switchProxy" json:"switchProxy"`       // Retry through a different upstream proxy
+	SwitchProfile  bool     `yaml:"switchProfile" json:"switchProfile"`   // Retry as a different browser profile
+}
+
+// Kinds of transient failures, as reported by transientReason
+const (
+	retryTimeout = "timeout" // a step ran out of time
+	retryNetwork = "network" // the connection to Threads failed
+	retryProxy   = "proxy"   // the upstream proxy failed
+	retryBrowser = "browser" // the page or the browser itself died
+)
+
+// extractAttempt is what one try of an extraction used, so a retry can pick
+// differently
+type extractAttempt struct {
+	number   int
+	profile  BrowserProfile
+	proxy    *upstreamProxy
+	strategy string // set by extractAttempt to the strategy that succeeded
+}
+
+// nextAttempt picks the profile and proxy for attempt n; prev is the attempt
+// that failed before it, nil for the first one
+func (te *ThreadsExtractor) nextAttempt(key string, n int, prev *extractAttempt) *extractAttempt {
+	retry := te.cfg.Extraction.Retry
+	att := &extractAttempt{number: n, strategy: "none"}
+	switch {
+	case prev == nil:
+		att.profile = te.profiles.pick()
+	case retry.SwitchProfile:
+		att.profile = te.profiles.pickOther(prev.profile.Name)
+	default:
+		att.profile = prev.profile
+	}
+	if prev != nil && retry.SwitchProxy {
+		att.proxy = te.proxies.pickExcept(key, prev.proxy)
+	} else {
+		att.proxy = te.proxies.pick(key)
+	}
+	return att
+}
+
+// budget returns the time after which no retry may start: extraction.retry.maxTotal
+// after start, or the deadline of ctx when that comes first
+func (c RetryConfig) budget(ctx context.Context, start time.Time) time.Time {
+	budget := start.Add(c.MaxTotal.Std())
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(budget) {
+		budget = deadline
+	}
+	return budget
+}
+
+// delay returns the wait before retry number n (1 for the first retry): the
+// base delay doubled per retry up to the cap, with jitter so retries of
+// requests that failed together spread out
+func (c RetryConfig) delay(n int) time.Duration {
+	d := c.BaseDelay.Std()
+	for i := 1; i < n && d < c.MaxDelay.Std(); i++ {
+		d *= 2
+	}
+	d = min(d, c.MaxDelay.Std())
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Chromium net errors that say nothing about the post, only the connection
+var transientNetErrors = []string{
+	"net::ERR_TIMED_OUT",
+	"net::ERR_CONNECTION_RESET",
+	"net::ERR_CONNECTION_CLOSED",
+	"net::ERR_CONNECTION_REFUSED",
+	"net::ERR_CONNECTION_TIMED_OUT",
+	"net::ERR_EMPTY_RESPONSE",
+	"net::ERR_NETWORK_CHANGED",
+	"net::ERR_INTERNET_DISCONNECTED",
+	"net::ERR_NAME_RESOLUTION_FAILED",
+	"net::ERR_HTTP2_PROTOCOL_ERROR",
+}
+
+// transientReason classifies a failed attempt: the kind of transient failure
+// another attempt may get past, or "" when it would fail the same way
+func (te *ThreadsExtractor) transientReason(err error) string {
+	// Blocks have a backoff of their own, and a missing post stays missing
+	var stateErr *pageStateError
+	if errors.As(err, &stateErr) {
+		return ""
+	}
+
+	var navErr *rod.NavigationError
+	if errors.As(err, &navErr) {
+		if strings.Contains(navErr.Reason, "PROXY") || strings.Contains(navErr.Reason, "TUNNEL") || strings.Contains(navErr.Reason, "SOCKS") {
+			return retryProxy
+		}
+		for _, reason := range transientNetErrors {
+			if strings.HasPrefix(navErr.Reason, reason) {
+				return retryNetwork
+			}
+		}
+		return ""
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return retryTimeout
+	}
+
+	var cdpErr *cdp.Error
+	if errors.As(err, &cdpErr) {
+		switch {
+		case strings.Contains(cdpErr.Message, "Target closed"),
+			strings.Contains(cdpErr.Message, "Session with given id not found"),
+			strings.Contains(cdpErr.Message, "Not attached to an active page"),
+			strings.Contains(cdpErr.Message, "Execution context was destroyed"):
+			return retryBrowser
+		}
+	}
+
+	// A crashed browser fails with whatever the dead connection returned. The
+	// next attempt's page relaunches it.
+	if !te.browserAlive() {
+		return retryBrowser
+	}
+	return ""
+}
+
+// browserAlive reports whether the browser still answers
+func (te *ThreadsExtractor) browserAlive() bool {
+	browser := te.currentBrowser()
+	if browser == nil {
+		return true
+	}
+	_, err := browser.Timeout(2 * time.Second).Version()
+	return err == nil
+}
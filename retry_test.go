@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/cdp"
+)
+
+func TestRetryDelay(t *testing.T) {
+	cfg := DefaultConfig().Extraction.Retry
+	cfg.BaseDelay = Duration(100 * time.Millisecond)
+	cfg.MaxDelay = Duration(300 * time.Millisecond)
+
+	for n, full := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 6: 300 * time.Millisecond} {
+		for i := 0; i < 20; i++ {
+			if d := cfg.delay(n); d < full/2 || d > full {
+				t.Fatalf("delay(%d) = %v, want between %v and %v", n, d, full/2, full)
+			}
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	cfg := DefaultConfig().Extraction.Retry
+	start := time.Now()
+
+	if got := cfg.budget(context.Background(), start); !got.Equal(start.Add(cfg.MaxTotal.Std())) {
+		t.Errorf("budget without deadline = %v, want maxTotal after start", got.Sub(start))
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(10*time.Second))
+	defer cancel()
+	if got := cfg.budget(ctx, start); !got.Equal(start.Add(10 * time.Second)) {
+		t.Errorf("budget with an earlier deadline = %v, want the deadline", got.Sub(start))
+	}
+}
+
+func TestTransientReason(t *testing.T) {
+	te := &ThreadsExtractor{cfg: DefaultConfig()}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("failed to navigate to Threads post: %w", context.DeadlineExceeded), retryTimeout},
+		{fmt.Errorf("failed to navigate to Threads post: %w", &rod.NavigationError{Reason: "net::ERR_PROXY_CONNECTION_FAILED"}), retryProxy},
+		{fmt.Errorf("failed to navigate to Threads post: %w", &rod.NavigationError{Reason: "net::ERR_CONNECTION_RESET"}), retryNetwork},
+		{fmt.Errorf("failed to navigate to Threads post: %w", &rod.NavigationError{Reason: "net::ERR_ABORTED"}), ""},
+		{fmt.Errorf("failed to apply browser profile: %w", &cdp.Error{Code: -32000, Message: "Target closed"}), retryBrowser},
+		{&pageStateError{State: pageStateRateLimited}, ""},
+		{fmt.Errorf("wrapped: %w", &pageStateError{State: pageStateUnavailable}), ""},
+		{errors.New("Threads extraction failed - unable to find media URLs in page source"), ""},
+	}
+	for _, tt := range tests {
+		if got := te.transientReason(tt.err); got != tt.want {
+			t.Errorf("transientReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestNextAttemptSwitchesClient(t *testing.T) {
+	cfg := DefaultConfig()
+	pool, _ := newTestProxyPool(t, "http://a:1", "http://b:2")
+	te := &ThreadsExtractor{cfg: cfg, profiles: newProfileRotator(cfg.Browser), proxies: pool}
+
+	first := te.nextAttempt("post", 1, nil)
+	second := te.nextAttempt("post", 2, first)
+	if second.proxy == first.proxy {
+		t.Errorf("retry kept proxy %s", first.proxy.label)
+	}
+	if second.profile.Name == first.profile.Name {
+		t.Errorf("retry kept profile %s", first.profile.Name)
+	}
+	if got := pool.pick("post"); got != second.proxy {
+		t.Error("the post should stick to the proxy of the latest attempt")
+	}
+
+	cfg.Extraction.Retry.SwitchProxy = false
+	cfg.Extraction.Retry.SwitchProfile = false
+	third := te.nextAttempt("post", 3, second)
+	if third.proxy != second.proxy || third.profile.Name != second.profile.Name {
+		t.Error("retry switched client although switching is off")
+	}
+}
+
+func TestExtractRetriesTimeout(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// The first attempt never gets an answer
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><video src="https://scontent.cdninstagram.com/v/clip.mp4"></video></body></html>`))
+	}))
+	defer srv.Close()
+
+	te := newTestExtractor(t, srv)
+	te.cfg.Extraction.HTTPFirst = false
+	te.cfg.Extraction.NavigationTimeout = Duration(time.Second)
+	te.cfg.Extraction.Retry.BaseDelay = Duration(10 * time.Millisecond)
+	te.cfg.Extraction.Retry.MinAttemptTime = 0
+
+	result, err := te.extractMediaURL(context.Background(), "https://www.threads.net/@user/post/ABC123")
+	if err != nil {
+		t.Fatalf("expected the retry to succeed: %v", err)
+	}
+	if result.MediaURL != "https://scontent.cdninstagram.com/v/clip.mp4" {
+		t.Errorf("media URL = %s", result.MediaURL)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// drainState tracks whether the server is shutting down and how much work is still running
+type drainState struct {
+	draining atomic.Bool
+	inFlight atomic.Int64
+}
+
+// middleware rejects new requests once draining starts and counts in-flight ones
+func (d *drainState) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.draining.Load() {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "5")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Error:   "Server is shutting down",
+				Success: false,
+			})
+			return
+		}
+
+		d.inFlight.Add(1)
+		defer d.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// runServer serves until ctx is cancelled, then drains in-flight requests for up to timeout
+func runServer(ctx context.Context, srv *http.Server, drain *drainState, timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	drain.draining.Store(true)
+	slog.Info("shutdown signal received, draining", "in_flight", drain.inFlight.Load(), "timeout", timeout.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Shutdown stops accepting connections and waits for active requests to finish
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("drain timed out, forcing close", "in_flight", drain.inFlight.Load(), "error", err)
+		srv.Close()
+		return err
+	}
+
+	slog.Info("all in-flight requests drained")
+	return nil
+}
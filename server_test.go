@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainMiddleware(t *testing.T) {
+	drain := &drainState{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := drain.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	slow := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+		slow <- w.Code
+	}()
+	<-started
+	if n := drain.inFlight.Load(); n != 1 {
+		t.Errorf("in flight = %d, want 1", n)
+	}
+
+	drain.draining.Store(true)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/fast", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("request while draining = %d (Retry-After %q), want 503", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("in-flight request = %d, want 200", code)
+	}
+	if n := drain.inFlight.Load(); n != 0 {
+		t.Errorf("in flight = %d after it finished, want 0", n)
+	}
+}
+
+func TestRunServerDrainsInFlight(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	drain := &drainState{}
+	started := make(chan struct{})
+	srv := &http.Server{
+		Addr: addr,
+		Handler: drain.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			io.WriteString(w, "done")
+		})),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runServer(ctx, srv, drain, 5*time.Second) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		// The listener may not be up yet
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get("http://" + addr + "/"); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resCh <- result{string(body), err}
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("request never reached the server")
+	}
+	cancel()
+
+	res := <-resCh
+	if res.err != nil || res.body != "done" {
+		t.Errorf("in-flight request = %q, %v; want it to finish", res.body, res.err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("runServer = %v, want a clean drain", err)
+	}
+	if !drain.draining.Load() {
+		t.Error("server did not enter draining")
+	}
+}
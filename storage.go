@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Storage persists archived media under content-addressed keys
+type Storage interface {
+	// Exists reports whether key is already stored
+	Exists(ctx context.Context, key string) (bool, error)
+	// Put stores size bytes from r under key. sha256Hex is the hex digest of the
+	// content, which backends may use for integrity checks.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType, sha256Hex string) error
+	// URL returns the URL clients use to fetch key
+	URL(key string) string
+	// Ping checks that the backend is reachable and holds the configured
+	// directory or bucket
+	Ping(ctx context.Context) error
+}
+
+// NewStorage creates the backend selected in cfg; it returns nil when archive
+// mode is disabled
+func NewStorage(cfg StorageConfig) (Storage, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "local":
+		return newLocalStorage(cfg.Local)
+	case "s3":
+		return newS3Storage(cfg.S3), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// contentKey names a file after its SHA-256, fanned out over two directory
+// levels so no single directory grows too large
+func contentKey(sha256Hex, ext string) string {
+	return path.Join(sha256Hex[:2], sha256Hex[2:4], sha256Hex+ext)
+}
+
+// mediaExtension picks a file extension from the Content-Type, then the URL
+func mediaExtension(contentType, mediaURL string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mediaType {
+		case "video/mp4":
+			return ".mp4"
+		case "image/jpeg":
+			return ".jpg"
+		case "image/webp":
+			return ".webp"
+		case "image/png":
+			return ".png"
+		case "audio/mp4":
+			return ".m4a"
+		}
+	}
+	if u, err := url.Parse(mediaURL); err == nil {
+		if ext := strings.ToLower(path.Ext(u.Path)); ext != "" && len(ext) <= 5 {
+			return ext
+		}
+	}
+	return ""
+}
+
+// localStorage keeps files in a directory that the server exposes under BaseURL
+type localStorage struct {
+	dir     string
+	baseURL string
+}
+
+func newLocalStorage(cfg LocalStorageConfig) (*localStorage, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &localStorage{dir: cfg.Dir, baseURL: strings.TrimSuffix(cfg.BaseURL, "/")}, nil
+}
+
+func (s *localStorage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *localStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType, sha256Hex string) error {
+	dest := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (s *localStorage) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.dir)
+	}
+	return nil
+}
+
+func (s *localStorage) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// Handler serves the stored files for the BaseURL route
+func (s *localStorage) Handler() http.Handler {
+	return http.StripPrefix(s.baseURL, http.FileServer(http.Dir(s.dir)))
+}
+
+// s3Storage talks to any S3-compatible server with SigV4-signed requests
+type s3Storage struct {
+	cfg    S3StorageConfig
+	client *http.Client
+	now    func() time.Time
+}
+
+func newS3Storage(cfg S3StorageConfig) *s3Storage {
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+	return &s3Storage{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 5 * time.Minute},
+		now:    time.Now,
+	}
+}
+
+// bucketURL is the API URL of the bucket, path-style or virtual-hosted
+func (s *s3Storage) bucketURL() string {
+	if s.cfg.PathStyle {
+		return s.cfg.Endpoint + "/" + s.cfg.Bucket
+	}
+	u, err := url.Parse(s.cfg.Endpoint)
+	if err != nil {
+		return s.cfg.Endpoint + "/" + s.cfg.Bucket
+	}
+	return u.Scheme + "://" + s.cfg.Bucket + "." + u.Host
+}
+
+// objectURL is the API URL of key
+func (s *s3Storage) objectURL(key string) string {
+	if s.cfg.Prefix != "" {
+		key = s.cfg.Prefix + "/" + key
+	}
+	return s.bucketURL() + "/" + key
+}
+
+// Ping sends a HeadBucket request, which fails on bad credentials as well as
+// an unreachable endpoint
+func (s *s3Storage) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", s.bucketURL(), nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, emptyPayloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3 HEAD bucket %s: status %d", s.cfg.Bucket, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *s3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", s.objectURL(key), nil)
+	if err != nil {
+		return false, err
+	}
+	s.sign(req, emptyPayloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("s3 HEAD %s: status %d", key, resp.StatusCode)
+	}
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType, sha256Hex string) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", s.objectURL(key), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, sha256Hex)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 PUT %s: status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *s3Storage) URL(key string) string {
+	if s.cfg.PublicURL == "" {
+		return s.objectURL(key)
+	}
+	if s.cfg.Prefix != "" {
+		key = s.cfg.Prefix + "/" + key
+	}
+	return s.cfg.PublicURL + "/" + key
+}
+
+// emptyPayloadHash is the SHA-256 of an empty body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds AWS Signature Version 4 headers to req. Every header already set on
+// req is signed along with host, x-amz-content-sha256 and x-amz-date.
+func (s *s3Storage) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query parameters sorted by name as SigV4 requires
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), q[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything except unreserved characters
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ArchivedMedia describes a media file copied into our storage
+type ArchivedMedia struct {
+	URL          string `json:"url"`
+	Key          string `json:"key"`
+	SHA256       string `json:"sha256"`
+	Size         int64  `json:"size"`
+	ContentType  string `json:"contentType,omitempty"`
+	SourceURL    string `json:"sourceUrl"`
+	Deduplicated bool   `json:"deduplicated,omitempty"` // The same content was already stored
+}
+
+// mediaArchiver downloads media through the shared fetcher and stores it
+type mediaArchiver struct {
+	fetcher *mediaFetcher
+	storage Storage
+}
+
+// archive copies mediaURL into storage. The body is spooled to a temp file while
+// hashing, since the key depends on the content.
+func (a *mediaArchiver) archive(ctx context.Context, mediaURL string) (*ArchivedMedia, error) {
+	ctx, span := startSpan(ctx, "archive")
+	var err error
+	defer func() { span.Finish(err) }()
+
+	resp, err := a.fetcher.open(ctx, mediaURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch media: %w", err)
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp("", "threadsvid-archive-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download media: %v", err)
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	contentType := resp.Header.Get("Content-Type")
+	key := contentKey(digest, mediaExtension(contentType, mediaURL))
+	media := &ArchivedMedia{
+		URL:         a.storage.URL(key),
+		Key:         key,
+		SHA256:      digest,
+		Size:        size,
+		ContentType: contentType,
+		SourceURL:   mediaURL,
+	}
+	span.SetAttr("archive.key", key)
+	span.SetAttr("archive.bytes", size)
+
+	exists, err := a.storage.Exists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check storage: %v", err)
+	}
+	if exists {
+		media.Deduplicated = true
+		return media, nil
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err = a.storage.Put(ctx, key, tmp, size, contentType, digest); err != nil {
+		return nil, fmt.Errorf("failed to store media: %v", err)
+	}
+	return media, nil
+}
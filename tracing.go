@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TracingConfig controls span export
+type TracingConfig struct {
+	Endpoint      string            `yaml:"endpoint" json:"endpoint"`           // OTLP/HTTP base URL, e.g. http://localhost:4318 (empty = no-op)
+	ServiceName   string            `yaml:"serviceName" json:"serviceName"`     // Reported as service.name
+	Headers       map[string]string `yaml:"headers" json:"headers"`             // Extra headers sent to the collector
+	BatchSize     int               `yaml:"batchSize" json:"batchSize"`         // Spans per export request
+	FlushInterval Duration          `yaml:"flushInterval" json:"flushInterval"` // Max time a span waits before export
+}
+
+// Span is a single timed stage of work
+type Span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Name     string
+	Kind     int // OTLP span kind: 1 internal, 2 server
+	Start    time.Time
+	End      time.Time
+	Attrs    map[string]string
+	ErrorMsg string
+
+	ended    atomic.Bool
+	tracer   *Tracer
+	recorder *spanRecorder
+}
+
+// StageTiming is one entry of the per-response timings breakdown
+type StageTiming struct {
+	Stage      string  `json:"stage"`
+	StartMs    float64 `json:"startMs"` // Offset from the start of the request
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// spanExporter ships finished spans somewhere
+type spanExporter interface {
+	export(span *Span)
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer creates spans and hands finished ones to an exporter
+type Tracer struct {
+	exporter spanExporter
+}
+
+// tracer is the process-wide tracer; it is a no-op until main installs an exporter
+var tracer = &Tracer{}
+
+type spanContextKey struct{}
+type spanRecorderContextKey struct{}
+
+// spanRecorder collects every span of one request so they can be reported back as timings
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// withSpanRecorder makes every span started under ctx also recorded for timings
+func withSpanRecorder(ctx context.Context) (context.Context, *spanRecorder) {
+	rec := &spanRecorder{}
+	return context.WithValue(ctx, spanRecorderContextKey{}, rec), rec
+}
+
+// Timings returns the recorded spans relative to the earliest start, in start order
+func (r *spanRecorder) Timings() []StageTiming {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.spans) == 0 {
+		return nil
+	}
+
+	origin := r.spans[0].Start
+	for _, s := range r.spans {
+		if s.Start.Before(origin) {
+			origin = s.Start
+		}
+	}
+
+	timings := make([]StageTiming, 0, len(r.spans))
+	for _, s := range r.spans {
+		timings = append(timings, StageTiming{
+			Stage:      s.Name,
+			StartMs:    float64(s.Start.Sub(origin).Microseconds()) / 1000,
+			DurationMs: float64(s.End.Sub(s.Start).Microseconds()) / 1000,
+			Error:      s.ErrorMsg,
+		})
+	}
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].StartMs < timings[j].StartMs
+	})
+	return timings
+}
+
+// startSpan starts a span as a child of whatever span ctx carries
+func startSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return tracer.start(ctx, name, 1)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	rec, _ := ctx.Value(spanRecorderContextKey{}).(*spanRecorder)
+
+	span := &Span{
+		SpanID:   randomHex(8),
+		Name:     name,
+		Kind:     kind,
+		Start:    time.Now(),
+		tracer:   t,
+		recorder: rec,
+	}
+
+	if parent, ok := ctx.Value(spanContextKey{}).(*Span); ok {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else if remote, ok := ctx.Value(remoteParentContextKey{}).(remoteParent); ok {
+		span.TraceID = remote.traceID
+		span.ParentID = remote.spanID
+	} else {
+		span.TraceID = randomHex(16)
+	}
+
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// SetAttr attaches a string attribute to the span
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]string)
+	}
+	s.Attrs[key] = fmt.Sprint(value)
+}
+
+// RecordError marks the span as failed
+func (s *Span) RecordError(err error) {
+	if err != nil {
+		s.ErrorMsg = err.Error()
+	}
+}
+
+// Finish ends the span, recording err if it is non-nil. Only the first call counts.
+func (s *Span) Finish(err error) {
+	if !s.ended.CompareAndSwap(false, true) {
+		return
+	}
+	s.RecordError(err)
+	s.End = time.Now()
+
+	if s.recorder != nil {
+		s.recorder.mu.Lock()
+		s.recorder.spans = append(s.recorder.spans, s)
+		s.recorder.mu.Unlock()
+	}
+	if s.tracer != nil && s.tracer.exporter != nil {
+		s.tracer.exporter.export(s)
+	}
+}
+
+// remoteParent is a span context received in a W3C traceparent header
+type remoteParent struct {
+	traceID string
+	spanID  string
+}
+
+type remoteParentContextKey struct{}
+
+// withTraceparent continues an incoming W3C trace context if the header is valid
+func withTraceparent(ctx context.Context, header string) context.Context {
+	// version-traceid-parentid-flags, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil || parts[1] == strings.Repeat("0", 32) {
+		return ctx
+	}
+	if _, err := hex.DecodeString(parts[2]); err != nil || parts[2] == strings.Repeat("0", 16) {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteParentContextKey{}, remoteParent{traceID: parts[1], spanID: parts[2]})
+}
+
+// withTracing starts a server span per request, continuing any incoming traceparent
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := withTraceparent(r.Context(), r.Header.Get("traceparent"))
+		ctx, span := tracer.start(ctx, r.Method+" "+r.URL.Path, 2)
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("http.target", r.URL.Path)
+		if id := requestIDFrom(ctx); id != "" {
+			span.SetAttr("request.id", id)
+		}
+		defer span.Finish(nil)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return strings.Repeat("0", 2*n-1) + "1"
+	}
+	return hex.EncodeToString(b)
+}
+
+// otlpExporter batches spans and posts them to an OTLP/HTTP collector as JSON
+type otlpExporter struct {
+	endpoint      string
+	serviceName   string
+	headers       map[string]string
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+
+	spans   chan *Span
+	done    chan struct{}
+	stopped chan struct{}
+	dropped atomic.Int64
+}
+
+// newOTLPExporter starts a background exporter for cfg
+func newOTLPExporter(cfg TracingConfig) *otlpExporter {
+	e := &otlpExporter{
+		endpoint:      strings.TrimRight(cfg.Endpoint, "/") + "/v1/traces",
+		serviceName:   cfg.ServiceName,
+		headers:       cfg.Headers,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval.Std(),
+		client:        &http.Client{Timeout: 10 * time.Second},
+		spans:         make(chan *Span, 4096),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *otlpExporter) export(span *Span) {
+	select {
+	case e.spans <- span:
+	default:
+		// Never block the request path on a slow collector
+		e.dropped.Add(1)
+	}
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.post(batch); err != nil {
+			slog.Warn("failed to export spans", "spans", len(batch), "error", err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			// Drain whatever is still queued before exiting
+			for {
+				select {
+				case span := <-e.spans:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown flushes queued spans, waiting at most until ctx is done
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	close(e.done)
+	select {
+	case <-e.stopped:
+		if n := e.dropped.Load(); n > 0 {
+			slog.Warn("spans dropped because the export queue was full", "dropped", n)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OTLP/JSON wire types, see opentelemetry-proto's trace.proto
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// encodeOTLP converts spans to an OTLP/JSON export request
+func encodeOTLP(serviceName string, spans []*Span) otlpTraceRequest {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "threadsvid"
+
+	for _, s := range spans {
+		out := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: 1},
+		}
+		for k, v := range s.Attrs {
+			out.Attributes = append(out.Attributes, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: v}})
+		}
+		if s.ErrorMsg != "" {
+			out.Status = otlpStatus{Code: 2, Message: s.ErrorMsg}
+		}
+		scope.Spans = append(scope.Spans, out)
+	}
+
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	rs.Resource.Attributes = []otlpKeyValue{{Key: "service.name", Value: otlpAnyValue{StringValue: serviceName}}}
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+func (e *otlpExporter) post(spans []*Span) error {
+	body, err := json.Marshal(encodeOTLP(e.serviceName, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpanParentChild(t *testing.T) {
+	ctx, rec := withSpanRecorder(context.Background())
+	ctx, parent := startSpan(ctx, "extract")
+	time.Sleep(2 * time.Millisecond)
+	_, child := startSpan(ctx, "navigate")
+	time.Sleep(2 * time.Millisecond)
+	child.Finish(errors.New("timed out"))
+	parent.Finish(nil)
+	parent.Finish(errors.New("ignored")) // only the first Finish counts
+
+	if child.TraceID != parent.TraceID || len(parent.TraceID) != 32 {
+		t.Errorf("trace IDs = %q and %q, want one shared 32-char ID", parent.TraceID, child.TraceID)
+	}
+	if child.ParentID != parent.SpanID || parent.ParentID != "" {
+		t.Errorf("child parent = %q (parent span %q, its parent %q)", child.ParentID, parent.SpanID, parent.ParentID)
+	}
+	if child.Start.Before(parent.Start) || child.End.After(parent.End) {
+		t.Errorf("child [%v, %v] is not within parent [%v, %v]", child.Start, child.End, parent.Start, parent.End)
+	}
+	if parent.ErrorMsg != "" || child.ErrorMsg != "timed out" {
+		t.Errorf("errors = %q / %q", parent.ErrorMsg, child.ErrorMsg)
+	}
+
+	timings := rec.Timings()
+	if len(timings) != 2 || timings[0].Stage != "extract" || timings[1].Stage != "navigate" {
+		t.Fatalf("timings = %+v, want extract then navigate", timings)
+	}
+	if timings[0].StartMs != 0 || timings[1].StartMs <= 0 {
+		t.Errorf("start offsets = %v, %v", timings[0].StartMs, timings[1].StartMs)
+	}
+	if timings[1].DurationMs > timings[0].DurationMs {
+		t.Errorf("child took %vms, longer than its parent's %vms", timings[1].DurationMs, timings[0].DurationMs)
+	}
+	if timings[1].Error != "timed out" {
+		t.Errorf("child timing error = %q", timings[1].Error)
+	}
+}
+
+func TestWithTraceparent(t *testing.T) {
+	const traceID, spanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	tests := map[string]bool{
+		"00-" + traceID + "-" + spanID + "-01":                  true,
+		"00-" + strings.Repeat("0", 32) + "-" + spanID + "-01":  false,
+		"00-" + traceID + "-" + strings.Repeat("0", 16) + "-01": false,
+		"00-" + traceID + "-" + spanID:                          false,
+		"00-zzzz2f3577b34da6a3ce929d0e0e4736-" + spanID + "-01": false,
+		"": false,
+	}
+	for header, continued := range tests {
+		_, span := startSpan(withTraceparent(context.Background(), header), "op")
+		if got := span.TraceID == traceID && span.ParentID == spanID; got != continued {
+			t.Errorf("traceparent %q: trace %s parent %s, continued = %v", header, span.TraceID, span.ParentID, got)
+		}
+	}
+}
+
+func TestEncodeOTLPShape(t *testing.T) {
+	start := time.Unix(1700000000, 123456789)
+	spans := []*Span{
+		{TraceID: "t1", SpanID: "s1", Name: "GET /api/extract", Kind: 2, Start: start, End: start.Add(time.Second), Attrs: map[string]string{"http.method": "GET"}},
+		{TraceID: "t1", SpanID: "s2", ParentID: "s1", Name: "navigate", Kind: 1, Start: start, End: start.Add(time.Millisecond), ErrorMsg: "boom"},
+	}
+	body, err := json.Marshal(encodeOTLP("threadsvid-test", spans))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decode generically so the test checks the wire field names, not the Go types
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]interface{} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Scope struct {
+					Name string `json:"name"`
+				} `json:"scope"`
+				Spans []map[string]interface{} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected structure: %s", body)
+	}
+	rs := req.ResourceSpans[0]
+	attr := rs.Resource.Attributes[0]
+	if attr["key"] != "service.name" || attr["value"].(map[string]interface{})["stringValue"] != "threadsvid-test" {
+		t.Errorf("resource attributes = %v", rs.Resource.Attributes)
+	}
+	scope := rs.ScopeSpans[0]
+	if scope.Scope.Name != "threadsvid" || len(scope.Spans) != 2 {
+		t.Fatalf("scope = %s with %d spans", scope.Scope.Name, len(scope.Spans))
+	}
+
+	server, child := scope.Spans[0], scope.Spans[1]
+	// Timestamps are strings of nanoseconds, as OTLP/JSON encodes 64-bit integers
+	if server["startTimeUnixNano"] != strconv.FormatInt(start.UnixNano(), 10) ||
+		server["endTimeUnixNano"] != strconv.FormatInt(start.Add(time.Second).UnixNano(), 10) {
+		t.Errorf("server span times = %v, %v", server["startTimeUnixNano"], server["endTimeUnixNano"])
+	}
+	if server["kind"] != float64(2) || child["kind"] != float64(1) {
+		t.Errorf("kinds = %v, %v", server["kind"], child["kind"])
+	}
+	if _, ok := server["parentSpanId"]; ok {
+		t.Error("root span should omit parentSpanId")
+	}
+	if child["parentSpanId"] != "s1" || child["traceId"] != "t1" || child["spanId"] != "s2" {
+		t.Errorf("child ids = %v", child)
+	}
+	if status := server["status"].(map[string]interface{}); status["code"] != float64(1) {
+		t.Errorf("server status = %v, want code 1", status)
+	}
+	if status := child["status"].(map[string]interface{}); status["code"] != float64(2) || status["message"] != "boom" {
+		t.Errorf("child status = %v, want code 2 with the error", status)
+	}
+	attrs := server["attributes"].([]interface{})
+	if len(attrs) != 1 || !strings.Contains(string(body), `{"key":"http.method","value":{"stringValue":"GET"}}`) {
+		t.Errorf("server attributes = %v", attrs)
+	}
+}
+
+func TestOTLPExporterPosts(t *testing.T) {
+	got := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- r
+		bodies <- body
+	}))
+	defer collector.Close()
+
+	e := newOTLPExporter(TracingConfig{
+		Endpoint:      collector.URL + "/",
+		ServiceName:   "svc",
+		Headers:       map[string]string{"Authorization": "Bearer collector-token"},
+		BatchSize:     1,
+		FlushInterval: Duration(time.Hour),
+	})
+	e.export(&Span{TraceID: "t", SpanID: "s", Name: "op", Kind: 1, Start: time.Now(), End: time.Now()})
+
+	select {
+	case r := <-got:
+		if r.Method != "POST" || r.URL.Path != "/v1/traces" {
+			t.Errorf("request = %s %s, want POST /v1/traces", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer collector-token" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		if body := <-bodies; !strings.Contains(string(body), `"spanId":"s"`) {
+			t.Errorf("body = %s", body)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("exporter never posted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteYAMLRedactsTracingHeaders(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Tracing.Headers = map[string]string{"Authorization": "Bearer collector-token"}
+
+	var out strings.Builder
+	if err := cfg.WriteYAML(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "collector-token") || !strings.Contains(out.String(), "Authorization: REDACTED") {
+		t.Errorf("tracing headers not redacted:\n%s", out.String())
+	}
+	if cfg.Tracing.Headers["Authorization"] != "Bearer collector-token" {
+		t.Error("WriteYAML modified the live configuration")
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FFmpegConfig controls the optional post-processing of downloads
+type FFmpegConfig struct {
+	Path          string   `yaml:"path" json:"path"`                   // ffmpeg binary, auto-detected if empty
+	Timeout       Duration `yaml:"timeout" json:"timeout"`             // Limit for a single ffmpeg run
+	MaxConcurrent int      `yaml:"maxConcurrent" json:"maxConcurrent"` // ffmpeg processes running at once
+	MaxGIFLength  Duration `yaml:"maxGifLength" json:"maxGifLength"`   // GIFs are cut to this length
+}
+
+// Output formats supported by the transcoder
+const (
+	formatMP4 = "mp4" // re-encoded H.264/AAC, smaller with a height limit
+	formatM4A = "m4a" // audio only
+	formatGIF = "gif" // silent animated preview
+)
+
+// TranscodeOptions describes how a downloaded file should be converted. The
+// zero value means "leave the file alone".
+type TranscodeOptions struct {
+	Format string
+	Start  time.Duration
+	End    time.Duration // 0 means the end of the media
+	Height int           // Output height in pixels, 0 keeps the source size
+}
+
+// Active reports whether any processing was requested
+func (o TranscodeOptions) Active() bool {
+	return o.Format != "" || o.Start > 0 || o.End > 0 || o.Height > 0
+}
+
+// ContentType is the MIME type of the processed output
+func (o TranscodeOptions) ContentType() string {
+	switch o.Format {
+	case formatM4A:
+		return "audio/mp4"
+	case formatGIF:
+		return "image/gif"
+	default:
+		return "video/mp4"
+	}
+}
+
+// Extension is the file extension of the processed output
+func (o TranscodeOptions) Extension() string {
+	if o.Format == "" {
+		return "." + formatMP4
+	}
+	return "." + o.Format
+}
+
+// Validate checks the options are consistent
+func (o TranscodeOptions) Validate() error {
+	switch o.Format {
+	case "", formatMP4, formatM4A, formatGIF:
+	default:
+		return fmt.Errorf("unsupported format %q, use mp4, m4a or gif", o.Format)
+	}
+	if o.Start < 0 || o.End < 0 {
+		return fmt.Errorf("start and end must not be negative")
+	}
+	if o.End > 0 && o.End <= o.Start {
+		return fmt.Errorf("end must be after start")
+	}
+	if o.Height < 0 || o.Height > 2160 {
+		return fmt.Errorf("height must be between 1 and 2160")
+	}
+	if o.Height > 0 && o.Format == formatM4A {
+		return fmt.Errorf("height does not apply to audio")
+	}
+	return nil
+}
+
+// parseTranscodeOptions reads format, start, end and height from query parameters
+func parseTranscodeOptions(q url.Values) (TranscodeOptions, error) {
+	var o TranscodeOptions
+	var err error
+
+	o.Format = strings.ToLower(q.Get("format"))
+	if v := q.Get("start"); v != "" {
+		if o.Start, err = parseTimestamp(v); err != nil {
+			return o, fmt.Errorf("invalid start: %v", err)
+		}
+	}
+	if v := q.Get("end"); v != "" {
+		if o.End, err = parseTimestamp(v); err != nil {
+			return o, fmt.Errorf("invalid end: %v", err)
+		}
+	}
+	if v := q.Get("height"); v != "" {
+		if o.Height, err = strconv.Atoi(v); err != nil {
+			return o, fmt.Errorf("invalid height %q", v)
+		}
+	}
+	return o, o.Validate()
+}
+
+// parseTimestamp accepts seconds ("12.5"), Go durations ("1m30s") and clock
+// time ("01:30", "00:01:30.5")
+func parseTimestamp(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("%q is not a time, use seconds, 1m30s or hh:mm:ss", s)
+	}
+	var total float64
+	for _, p := range parts {
+		n, err := strconv.ParseFloat(p, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a time, use seconds, 1m30s or hh:mm:ss", s)
+		}
+		total = total*60 + n
+	}
+	return time.Duration(total * float64(time.Second)), nil
+}
+
+// findFFmpeg resolves the ffmpeg binary: the configured path, then PATH, then
+// common install locations. It returns "" when ffmpeg isn't installed.
+func findFFmpeg(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	if path, err := exec.LookPath("ffmpeg"); err == nil {
+		return path
+	}
+
+	commonPaths := []string{
+		"/usr/bin/ffmpeg",
+		"/usr/local/bin/ffmpeg",
+		"/opt/homebrew/bin/ffmpeg",
+		"C:\\ffmpeg\\bin\\ffmpeg.exe",
+	}
+	for _, path := range commonPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// transcoder runs ffmpeg with bounded concurrency
+type transcoder struct {
+	path         string
+	timeout      time.Duration
+	maxGIFLength time.Duration
+	slots        chan struct{}
+}
+
+// newTranscoder returns nil when ffmpeg can't be found, which disables processing
+func newTranscoder(cfg FFmpegConfig) *transcoder {
+	path := findFFmpeg(cfg.Path)
+	if path == "" {
+		return nil
+	}
+	return &transcoder{
+		path:         path,
+		timeout:      cfg.Timeout.Std(),
+		maxGIFLength: cfg.MaxGIFLength.Std(),
+		slots:        make(chan struct{}, cfg.MaxConcurrent),
+	}
+}
+
+// ffmpegSeconds formats d the way ffmpeg expects time offsets
+func ffmpegSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// transcodeSourceHosts are the CDNs whose media /api/download will run
+// through ffmpeg, matched against the host and its parent domains
+var transcodeSourceHosts = []string{"cdninstagram.com", "fbcdn.net"}
+
+// transcodeSourceAllowed reports whether mediaURL is an https URL on one of
+// transcodeSourceHosts
+func transcodeSourceAllowed(mediaURL string) bool {
+	u, err := url.Parse(mediaURL)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range transcodeSourceHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// inputFormat sniffs the file at path and returns the ffmpeg demuxer for it.
+// Only MP4 and QuickTime files are accepted: left to probe, ffmpeg would also
+// take playlists and other formats that make it open further files or URLs.
+func inputFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read media: %v", err)
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if contentType == "video/mp4" {
+		return "mp4", nil
+	}
+	// The sniffer only knows the MP4 brands; QuickTime files declare "qt  "
+	if n >= 12 && string(head[4:8]) == "ftyp" && string(head[8:12]) == "qt  " {
+		return "mov", nil
+	}
+	return "", fmt.Errorf("unsupported media type %s", contentType)
+}
+
+// args builds the ffmpeg command line converting in, of demuxer format
+// inFormat, to out
+func (t *transcoder) args(in, inFormat, out string, o TranscodeOptions) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin", "-y"}
+
+	// Seeking before -i is fast and, when re-encoding, frame accurate
+	if o.Start > 0 {
+		args = append(args, "-ss", ffmpegSeconds(o.Start))
+	}
+	// Never let the input reach beyond the local file
+	args = append(args, "-protocol_whitelist", "file,pipe", "-f", inFormat, "-i", in)
+
+	length := time.Duration(0)
+	if o.End > 0 {
+		length = o.End - o.Start
+	}
+	if o.Format == formatGIF && t.maxGIFLength > 0 && (length == 0 || length > t.maxGIFLength) {
+		length = t.maxGIFLength
+	}
+	if length > 0 {
+		args = append(args, "-t", ffmpegSeconds(length))
+	}
+
+	switch o.Format {
+	case formatM4A:
+		args = append(args, "-vn", "-c:a", "aac", "-b:a", "192k", "-movflags", "+faststart")
+	case formatGIF:
+		height := o.Height
+		if height == 0 {
+			height = 320
+		}
+		// A per-clip palette keeps GIF colours from banding
+		filter := fmt.Sprintf("fps=12,scale=-2:%d:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse", height)
+		args = append(args, "-an", "-filter_complex", filter, "-loop", "0")
+	default:
+		if o.Height > 0 {
+			args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", o.Height))
+		}
+		args = append(args,
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "28",
+			"-c:a", "aac", "-b:a", "128k",
+			"-movflags", "+faststart",
+		)
+	}
+	return append(args, out)
+}
+
+// Run converts the file at in and returns the path of the output, placed next
+// to it. The caller removes both files.
+func (t *transcoder) Run(ctx context.Context, in string, o TranscodeOptions) (string, error) {
+	ctx, span := startSpan(ctx, "transcode")
+	span.SetAttr("transcode.format", o.Format)
+	var err error
+	defer func() { span.Finish(err) }()
+
+	select {
+	case t.slots <- struct{}{}:
+		defer func() { <-t.slots }()
+	case <-ctx.Done():
+		err = fmt.Errorf("waiting for a transcoder: %w", ctx.Err())
+		return "", err
+	}
+
+	inFormat, err := inputFormat(in)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	out := strings.TrimSuffix(in, filepath.Ext(in)) + ".out" + o.Extension()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.path, t.args(in, inFormat, out, o)...)
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	if err = cmd.Run(); err != nil {
+		os.Remove(out)
+		if ctx.Err() != nil {
+			err = fmt.Errorf("ffmpeg did not finish: %w", ctx.Err())
+			return "", err
+		}
+		err = fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		return "", err
+	}
+
+	loggerFrom(ctx).Debug("transcoded media", "format", o.Format, "duration_ms", time.Since(start).Milliseconds())
+	return out, nil
+}
+
+// transcodeFile converts the file at path in place of the original, returning
+// the new path (its extension follows the output format)
+func (t *transcoder) transcodeFile(ctx context.Context, path string, o TranscodeOptions) (string, error) {
+	out, err := t.Run(ctx, path, o)
+	if err != nil {
+		return "", err
+	}
+
+	dest := strings.TrimSuffix(path, filepath.Ext(path)) + o.Extension()
+	if err := os.Rename(out, dest); err != nil {
+		os.Remove(out)
+		return "", err
+	}
+	if dest != path {
+		os.Remove(path)
+	}
+	return dest, nil
+}
+
+// serveTranscoded downloads mediaURL to a temp directory, runs it through
+// ffmpeg and streams the result. Unlike plain downloads nothing can be sent
+// before ffmpeg finishes, so errors still get a proper status. Only media from
+// the Threads CDNs is processed.
+func serveTranscoded(w http.ResponseWriter, r *http.Request, fetcher *mediaFetcher, tc *transcoder, mediaURL, filename string, opts TranscodeOptions) {
+	logger := loggerFrom(r.Context())
+	if !transcodeSourceAllowed(mediaURL) {
+		recordError(r)
+		metrics.downloadResponses.Inc(strconv.Itoa(http.StatusBadRequest))
+		http.Error(w, "Only media from the Threads CDN can be processed", http.StatusBadRequest)
+		return
+	}
+	logger.Info("processing download", "media_url", mediaURL, "format", opts.Format,
+		"start", opts.Start.String(), "end", opts.End.String(), "height", opts.Height)
+
+	dir, err := os.MkdirTemp("", "threadsvid-transcode-*")
+	if err != nil {
+		logger.Error("failed to create temp directory", "error", err)
+		recordError(r)
+		metrics.downloadResponses.Inc(strconv.Itoa(http.StatusInternalServerError))
+		http.Error(w, "Failed to process media", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "source"+mediaExtension("", mediaURL))
+	if _, err := fetcher.save(r.Context(), mediaURL, src, nil); err != nil {
+		writeFetchError(w, r, err)
+		return
+	}
+
+	out, err := tc.Run(r.Context(), src, opts)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		logger.Warn("media processing failed", "error", err)
+		recordError(r)
+		metrics.downloadResponses.Inc(strconv.Itoa(http.StatusBadGateway))
+		http.Error(w, "Failed to process media", http.StatusBadGateway)
+		return
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		recordError(r)
+		metrics.downloadResponses.Inc(strconv.Itoa(http.StatusInternalServerError))
+		http.Error(w, "Failed to process media", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	if filename != "" {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + opts.Extension()
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	}
+	w.Header().Set("Content-Type", opts.ContentType())
+	if info, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+
+	metrics.downloadResponses.Inc(strconv.Itoa(http.StatusOK))
+	written, err := io.Copy(w, f)
+	recordBytesProxied(r, written)
+	metrics.proxiedBytes.Add(float64(written))
+	if err != nil {
+		logger.Warn("failed to stream processed media", "error", err)
+		recordError(r)
+		return
+	}
+
+	logger.Info("served processed download", "filename", filename, "bytes", written)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"12", 12 * time.Second},
+		{"12.5", 12500 * time.Millisecond},
+		{"1m30s", 90 * time.Second},
+		{"01:30", 90 * time.Second},
+		{"00:01:30.5", 90500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseTimestamp(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "abc", "1:2:3:4", "00:-1"} {
+		if _, err := parseTimestamp(bad); err == nil {
+			t.Errorf("parseTimestamp(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseTranscodeOptions(t *testing.T) {
+	valid := []struct {
+		query string
+		want  TranscodeOptions
+	}{
+		{"", TranscodeOptions{}},
+		{"format=GIF&start=2&end=5", TranscodeOptions{Format: formatGIF, Start: 2 * time.Second, End: 5 * time.Second}},
+		{"format=m4a", TranscodeOptions{Format: formatM4A}},
+		{"height=480", TranscodeOptions{Height: 480}},
+	}
+	for _, tt := range valid {
+		q, _ := url.ParseQuery(tt.query)
+		got, err := parseTranscodeOptions(q)
+		if err != nil || got != tt.want {
+			t.Errorf("parseTranscodeOptions(%q) = %+v, %v, want %+v", tt.query, got, err, tt.want)
+		}
+	}
+
+	invalid := []string{
+		"format=webm",
+		"start=5&end=2",
+		"end=abc",
+		"height=-1",
+		"height=big",
+		"format=m4a&height=480",
+	}
+	for _, query := range invalid {
+		q, _ := url.ParseQuery(query)
+		if _, err := parseTranscodeOptions(q); err == nil {
+			t.Errorf("parseTranscodeOptions(%q) should fail", query)
+		}
+	}
+
+	if (TranscodeOptions{}).Active() {
+		t.Errorf("zero options should be inactive")
+	}
+}
+
+func TestTranscoderArgs(t *testing.T) {
+	tc := &transcoder{path: "ffmpeg", maxGIFLength: 15 * time.Second}
+
+	args := strings.Join(tc.args("in.mp4", "mp4", "out.gif", TranscodeOptions{Format: formatGIF, Start: 10 * time.Second}), " ")
+	for _, want := range []string{"-ss 10.000 -protocol_whitelist file,pipe -f mp4 -i in.mp4", "-t 15.000", "scale=-2:320", "palettegen", "-an"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("gif args %q missing %q", args, want)
+		}
+	}
+
+	args = strings.Join(tc.args("in.mp4", "mp4", "out.mp4", TranscodeOptions{Start: 2 * time.Second, End: 5 * time.Second, Height: 480}), " ")
+	for _, want := range []string{"-ss 2.000", "-t 3.000", "scale=-2:480", "libx264", "out.mp4"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("mp4 args %q missing %q", args, want)
+		}
+	}
+
+	args = strings.Join(tc.args("in.mp4", "mp4", "out.m4a", TranscodeOptions{Format: formatM4A}), " ")
+	if !strings.Contains(args, "-vn") || strings.Contains(args, "-t ") || strings.Contains(args, "-ss") {
+		t.Errorf("unexpected m4a args %q", args)
+	}
+}
+
+func TestTranscodeSourceAllowed(t *testing.T) {
+	tests := map[string]bool{
+		"https://scontent-lhr8-1.cdninstagram.com/v/t50/clip.mp4?oh=1": true,
+		"https://video.xx.fbcdn.net/v/clip.mp4":                        true,
+		"https://cdninstagram.com/clip.mp4":                            true,
+		"http://scontent.cdninstagram.com/clip.mp4":                    false,
+		"https://evilcdninstagram.com/clip.mp4":                        false,
+		"https://cdninstagram.com.evil.com/clip.mp4":                   false,
+		"https://127.0.0.1/clip.mp4":                                   false,
+		"file:///etc/passwd":                                           false,
+		"not a url":                                                    false,
+	}
+	for mediaURL, want := range tests {
+		if got := transcodeSourceAllowed(mediaURL); got != want {
+			t.Errorf("transcodeSourceAllowed(%q) = %v, want %v", mediaURL, got, want)
+		}
+	}
+}
+
+func TestInputFormat(t *testing.T) {
+	ftyp := func(brands ...string) string {
+		box := strings.Join(brands, "")
+		return string([]byte{0, 0, 0, byte(8 + len(box))}) + "ftyp" + box
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"mp4", ftyp("isom", "\x00\x00\x02\x00", "isom", "mp41") + "moov", "mp4"},
+		{"quicktime", ftyp("qt  ", "\x00\x00\x02\x00", "qt  ") + "moov", "mov"},
+		{"hls playlist", "#EXTM3U\n#EXT-X-VERSION:3\nfile:///etc/passwd\n", ""},
+		{"concat list", "ffconcat version 1.0\nfile /etc/passwd\n", ""},
+		{"empty", "", ""},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		os.WriteFile(path, []byte(tt.content), 0o644)
+		got, err := inputFormat(path)
+		if got != tt.want || (tt.want == "") != (err != nil) {
+			t.Errorf("%s: inputFormat = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestServeTranscodedRejectsOtherHosts(t *testing.T) {
+	tc := &transcoder{path: "ffmpeg", slots: make(chan struct{}, 1)}
+	handler := handleDownload(DefaultConfig().Download, nil, tc)
+
+	media := newMediaServer(t, map[string]string{"/clip.mp4": "#EXTM3U"})
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/api/download?format=gif&url="+url.QueryEscape(media.URL+"/clip.mp4"), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for a non-CDN source, want 400", w.Code)
+	}
+}
+
+func TestTranscodeFile(t *testing.T) {
+	path := findFFmpeg("")
+	if path == "" {
+		t.Skip("ffmpeg not installed")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "clip.mp4")
+	gen := exec.Command(path, "-hide_banner", "-loglevel", "error", "-f", "lavfi", "-i", "testsrc=duration=3:size=320x240:rate=10",
+		"-f", "lavfi", "-i", "sine=duration=3", "-shortest", "-c:v", "libx264", "-c:a", "aac", src)
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Skipf("ffmpeg can't generate a test clip: %v: %s", err, out)
+	}
+
+	tc := newTranscoder(FFmpegConfig{Path: path, Timeout: Duration(time.Minute), MaxConcurrent: 1, MaxGIFLength: Duration(2 * time.Second)})
+	got, err := tc.transcodeFile(context.Background(), src, TranscodeOptions{Format: formatGIF, Height: 120})
+	if err != nil {
+		t.Fatalf("transcodeFile failed: %v", err)
+	}
+	if got != filepath.Join(dir, "clip.gif") {
+		t.Errorf("output path = %q", got)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("original file was not replaced")
+	}
+	data, err := os.ReadFile(got)
+	if err != nil || !strings.HasPrefix(string(data), "GIF8") {
+		t.Errorf("output is not a GIF: %v", err)
+	}
+}